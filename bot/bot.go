@@ -0,0 +1,175 @@
+// Package bot builds IRC bots on corgi's irc package: register handlers for
+// commands, numerics or patterns in messages, add "!command args" commands
+// with permission checks, and keep state per channel. Connection handling,
+// flood protection and reconnecting come from irc.Server.
+package bot
+
+import (
+	"errors"
+	"github.com/natemealey/corgi/irc"
+	"regexp"
+	"strings"
+)
+
+// an IRC bot on a single server. Handlers all run one at a time on the
+// goroutine that called Run, so they can use the Bot and its Server freely;
+// other goroutines should go through Do.
+type Bot struct {
+	Server *irc.Server
+	// joined once the server welcomes us, and again after reconnecting
+	Channels []string
+	// what commands start with in a channel. Private messages to the bot are
+	// treated as commands with or without it.
+	CommandPrefix string
+
+	loop     *irc.Loop
+	commands map[string]*Command
+	patterns []pattern
+	state    map[string]State
+	err      error // why Run stopped, if it wasn't Quit
+}
+
+// values a bot keeps for a channel, e.g. who was seen last. It lasts for as
+// long as the bot runs, across parts and reconnects.
+type State map[string]interface{}
+
+type pattern struct {
+	re      *regexp.Regexp
+	handler func(ctx *Context)
+}
+
+// a bot for the server at addr (host:port), not yet connected
+func New(addr, nick string, channels ...string) *Bot {
+	b := &Bot{
+		Server:        irc.NewServer(addr, nick, nick, nick),
+		Channels:      channels,
+		CommandPrefix: "!",
+		loop:          irc.NewLoop(),
+		commands:      make(map[string]*Command),
+		state:         make(map[string]State)}
+	b.Server.Dispatch = b.loop.Post
+	// lets servers that support it tell us who's logged in to which account
+	b.Server.Caps = []string{"account-tag"}
+	b.Server.Handle("001", func(ev *irc.Event) { b.joinChannels() })
+	b.Server.Handle("433", b.nickTaken)
+	b.Server.Handle(irc.Disconnected, b.disconnected)
+	b.Server.Handle("PRIVMSG", b.route)
+	b.AddCommand(&Command{Name: "help", Help: "lists the commands you can use", Handler: b.help})
+	return b
+}
+
+// connects and handles events until Quit is called. A dropped connection is
+// reconnected as long as Server.ReconnectDelay allows; with it turned off,
+// Run returns why the connection dropped.
+func (b *Bot) Run() error {
+	if err := b.Server.Connect(); err != nil {
+		return errors.New("failed to connect to " + b.Server.Addr + ": " + err.Error())
+	}
+	b.loop.Run()
+	return b.err
+}
+
+// stops Run if the connection dropped and won't be reconnected. Quitting
+// disconnects without an error, and Quit stops Run itself.
+func (b *Bot) disconnected(ev *irc.Event) {
+	if ev.Err != nil && b.Server.ReconnectDelay <= 0 {
+		b.err = errors.New("disconnected from " + b.Server.Addr + ": " + ev.Err.Error())
+		b.loop.Stop()
+	}
+}
+
+// sends QUIT with message and makes Run return. Safe to call from any
+// goroutine.
+func (b *Bot) Quit(message string) {
+	b.Do(func() {
+		b.Server.Disconnect(message)
+		b.loop.Stop()
+	})
+}
+
+// runs fn where the handlers run, for goroutines other than Run's
+func (b *Bot) Do(fn func()) {
+	b.loop.Post(fn)
+}
+
+// registers handler for every event with the given command, a numeric like
+// "001", one of the irc package's event constants or irc.AnyCommand
+func (b *Bot) On(command string, handler func(ctx *Context)) {
+	b.Server.Handle(command, func(ev *irc.Event) {
+		handler(b.newContext(ev))
+	})
+}
+
+// registers handler for every message matching expr, a regular expression.
+// Context.Matches holds the match and its submatches.
+func (b *Bot) Match(expr string, handler func(ctx *Context)) {
+	b.patterns = append(b.patterns, pattern{regexp.MustCompile(expr), handler})
+}
+
+// sends text to target, a channel or nick
+func (b *Bot) Say(target, text string) {
+	b.Server.SendText("PRIVMSG", target, text)
+}
+
+// the state kept for a channel, or for a nick's private messages
+func (b *Bot) State(target string) State {
+	target = strings.ToLower(target)
+	if b.state[target] == nil {
+		b.state[target] = make(State)
+	}
+	return b.state[target]
+}
+
+// joins the channels we're meant to be on that the server didn't already
+// rejoin for us
+func (b *Bot) joinChannels() {
+	var channelNames []string
+	for _, channelName := range b.Channels {
+		if b.Server.Channels[channelName] == nil {
+			channelNames = append(channelNames, channelName)
+		}
+	}
+	if len(channelNames) > 0 {
+		b.Server.Join(channelNames, nil)
+	}
+}
+
+// while registering, try the nick we wanted with more underscores until one
+// is free
+func (b *Bot) nickTaken(ev *irc.Event) {
+	if !b.Server.Registered() {
+		b.Server.SetNick(b.Server.Nick + "_")
+	}
+}
+
+// hands a PRIVMSG to the matching patterns and, if it's a command, the
+// router
+func (b *Bot) route(ev *irc.Event) {
+	if ev.Self {
+		return
+	}
+	text := ev.Text()
+	for _, p := range b.patterns {
+		if matches := p.re.FindStringSubmatch(text); matches != nil {
+			ctx := b.newContext(ev)
+			ctx.Matches = matches
+			p.handler(ctx)
+		}
+	}
+	private := !irc.IsChannel(ev.Param(0))
+	if strings.HasPrefix(text, b.CommandPrefix) {
+		text = strings.TrimPrefix(text, b.CommandPrefix)
+	} else if !private {
+		return
+	}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return
+	}
+	if cmd := b.commands[strings.ToLower(fields[0])]; cmd != nil {
+		ctx := b.newContext(ev)
+		ctx.Args = fields[1:]
+		ctx.ArgText = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), fields[0]))
+		b.runCommand(cmd, ctx)
+	}
+}
@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// a bot set up by setup and connected to a fake server, running until the
+// test ends
+func startBot(t *testing.T, setup func(b *Bot)) (*Bot, *irctest.Server, *irctest.Conn) {
+	fs := irctest.NewServer(t)
+	b := New(fs.Addr(), "testbot", "#bots")
+	b.Server.FloodRate = 0
+	b.Server.PingInterval = 0
+	setup(b)
+	done := make(chan error)
+	go func() { done <- b.Run() }()
+	t.Cleanup(func() {
+		b.Quit("")
+		<-done
+	})
+	c := fs.NextConn()
+	c.Expect("USER")
+	c.Expect("JOIN #bots")
+	return b, fs, c
+}
+
+// runs fn on the bot's loop and waits for it
+func onBot(b *Bot, fn func()) {
+	done := make(chan bool)
+	b.Do(func() {
+		fn()
+		close(done)
+	})
+	<-done
+}
+
+func TestCommands(t *testing.T) {
+	_, _, c := startBot(t, func(b *Bot) {
+		b.Command("echo", "says it back", func(ctx *Context) { ctx.Reply(ctx.ArgText) })
+		admin := b.Command("admin", "admins only", func(ctx *Context) { ctx.Reply("yes boss") })
+		admin.Hostmasks = []string{"*!*@admin.host"}
+		admin.Accounts = []string{"carol"}
+	})
+
+	c.Send(":alice!a@example.org PRIVMSG #bots :!echo hello   there")
+	c.Expect("PRIVMSG #bots :alice: hello   there")
+	c.Send(":alice!a@example.org PRIVMSG testbot :echo privately")
+	c.Expect("PRIVMSG alice :privately")
+
+	c.Send(":alice!a@example.org PRIVMSG #bots :!admin")
+	c.Expect("PRIVMSG #bots :alice: you're not allowed to use !admin")
+	c.Send(":bob!b@admin.host PRIVMSG #bots :!admin")
+	c.Expect("PRIVMSG #bots :bob: yes boss")
+	c.Send("@account=carol :carol!c@example.org PRIVMSG #bots :!admin")
+	c.Expect("PRIVMSG #bots :carol: yes boss")
+
+	c.Send(":alice!a@example.org PRIVMSG #bots :!help")
+	c.Expect("PRIVMSG #bots :alice: commands: !echo !help")
+}
+
+func TestPatternsAndState(t *testing.T) {
+	b, _, c := startBot(t, func(b *Bot) {
+		b.Match(`^(\w+)\+\+$`, func(ctx *Context) {
+			karma, _ := ctx.State()[ctx.Matches[1]].(int)
+			ctx.State()[ctx.Matches[1]] = karma + 1
+			ctx.Bot.Say(ctx.ReplyTo, ctx.Matches[1]+" now has "+strconv.Itoa(karma+1))
+		})
+	})
+	c.Send(":alice!a@example.org PRIVMSG #bots :go++")
+	c.Expect("PRIVMSG #bots :go now has 1")
+	c.Send(":alice!a@example.org PRIVMSG #bots :go++")
+	c.Expect("PRIVMSG #bots :go now has 2")
+	onBot(b, func() {
+		if b.State("#bots")["go"] != 2 || b.State("#elsewhere")["go"] != nil {
+			t.Errorf("state should be kept per channel")
+		}
+	})
+}
+
+func TestRejoinsAfterReconnect(t *testing.T) {
+	_, fs, c := startBot(t, func(b *Bot) {
+		b.Server.ReconnectDelay = 10 * time.Millisecond
+	})
+	c.Close()
+	c = fs.NextConn()
+	c.Expect("JOIN #bots")
+}
+
+func TestRunReturnsWithoutReconnect(t *testing.T) {
+	fs := irctest.NewServer(t)
+	b := New(fs.Addr(), "testbot", "#bots")
+	b.Server.FloodRate = 0
+	b.Server.PingInterval = 0
+	b.Server.ReconnectDelay = 0
+	done := make(chan error)
+	go func() { done <- b.Run() }()
+	c := fs.NextConn()
+	c.Expect("JOIN #bots")
+	c.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Run returned no error after the connection dropped")
+		}
+	case <-time.After(irctest.Timeout):
+		t.Fatalf("Run didn't return after the connection dropped")
+	}
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"github.com/natemealey/corgi/irc"
+	"sort"
+	"strings"
+)
+
+// a "!name args" command. If Hostmasks or Accounts are set, only senders
+// matching one of the hostmasks or logged in to one of the accounts may use
+// it; otherwise anyone can.
+type Command struct {
+	Name string
+	// a short description for !help
+	Help string
+	// masks like *!*@example.org, see irc.MatchMask
+	Hostmasks []string
+	// services accounts, known from the account tag on the sender's message
+	// when the server supports it
+	Accounts []string
+	Handler  func(ctx *Context)
+}
+
+// the event a handler is running for, and what it was matched with
+type Context struct {
+	*irc.Event
+	Bot *Bot
+	// where a reply should go: the channel, or the sender of a private message
+	ReplyTo string
+	// for commands, the words after the command name, and the same as a
+	// single string
+	Args    []string
+	ArgText string
+	// for patterns, the match and its submatches
+	Matches []string
+}
+
+func (b *Bot) newContext(ev *irc.Event) *Context {
+	ctx := &Context{Event: ev, Bot: b, ReplyTo: ev.Param(0)}
+	if !irc.IsChannel(ctx.ReplyTo) {
+		ctx.ReplyTo = ev.Nick()
+	}
+	return ctx
+}
+
+// answers where the event came from, addressing the sender in channels
+func (ctx *Context) Reply(text string) {
+	if irc.IsChannel(ctx.ReplyTo) {
+		text = ctx.Nick() + ": " + text
+	}
+	ctx.Bot.Say(ctx.ReplyTo, text)
+}
+
+// the state for the channel the event came from, or for the sender of a
+// private message
+func (ctx *Context) State() State {
+	return ctx.Bot.State(ctx.ReplyTo)
+}
+
+// the sender's services account, or "" if they aren't logged in or the
+// server doesn't say
+func (ctx *Context) Account() string {
+	if account := ctx.Tags["account"]; account != "*" {
+		return account
+	}
+	return ""
+}
+
+// adds cmd, replacing any command with the same name
+func (b *Bot) AddCommand(cmd *Command) {
+	b.commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+// adds a command anyone can use, returning it so permissions can be added
+func (b *Bot) Command(name, help string, handler func(ctx *Context)) *Command {
+	cmd := &Command{Name: name, Help: help, Handler: handler}
+	b.AddCommand(cmd)
+	return cmd
+}
+
+// whether the sender of ctx may use the command
+func (cmd *Command) Allows(ctx *Context) bool {
+	if len(cmd.Hostmasks) == 0 && len(cmd.Accounts) == 0 {
+		return true
+	}
+	for _, mask := range cmd.Hostmasks {
+		if irc.MatchMask(irc.NormalizeMask(mask), ctx.Prefix) {
+			return true
+		}
+	}
+	if account := ctx.Account(); account != "" {
+		for _, allowed := range cmd.Accounts {
+			if strings.EqualFold(allowed, account) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *Bot) runCommand(cmd *Command, ctx *Context) {
+	if !cmd.Allows(ctx) {
+		ctx.Reply("you're not allowed to use " + b.CommandPrefix + cmd.Name)
+		return
+	}
+	cmd.Handler(ctx)
+}
+
+// !help lists the commands the sender may use, !help <command> describes one
+func (b *Bot) help(ctx *Context) {
+	if len(ctx.Args) > 0 {
+		name := strings.ToLower(strings.TrimPrefix(ctx.Args[0], b.CommandPrefix))
+		if cmd := b.commands[name]; cmd != nil && cmd.Allows(ctx) {
+			ctx.Reply(b.CommandPrefix + cmd.Name + ": " + cmd.Help)
+		} else {
+			ctx.Reply("no such command " + ctx.Args[0])
+		}
+		return
+	}
+	var names []string
+	for _, cmd := range b.commands {
+		if cmd.Allows(ctx) {
+			names = append(names, b.CommandPrefix+cmd.Name)
+		}
+	}
+	sort.Strings(names)
+	ctx.Reply("commands: " + strings.Join(names, " "))
+}
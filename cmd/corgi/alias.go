@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the commands an alias expansion stands for, split at each `;` and with
+// their variables substituted: $1 to $9 are single arguments, $2- is the
+// second argument onwards, $* is all of them, $nick, $channel and $server
+// come from the current context and $$ is a literal $. An expansion that
+// doesn't use any arguments gets them appended to its last command instead.
+// Splitting comes first, so a `;` in the arguments can't start a command.
+func expandAlias(expansion string, args []string, vars map[string]string) []string {
+	parts := strings.Split(expansion, ";")
+	usedArgs := false
+	for idx, part := range parts {
+		var used bool
+		parts[idx], used = expandCommand(part, args, vars)
+		usedArgs = usedArgs || used
+	}
+	if !usedArgs && len(args) > 0 {
+		parts[len(parts)-1] += " " + strings.Join(args, " ")
+	}
+	return parts
+}
+
+// substitutes the variables in one command of an alias, returning whether it
+// used any arguments
+func expandCommand(expansion string, args []string, vars map[string]string) (string, bool) {
+	var (
+		expanded strings.Builder
+		usedArgs bool
+	)
+	for idx := 0; idx < len(expansion); idx++ {
+		if expansion[idx] != '$' || idx == len(expansion)-1 {
+			expanded.WriteByte(expansion[idx])
+			continue
+		}
+		rest := expansion[idx+1:]
+		switch {
+		case rest[0] == '$':
+			expanded.WriteByte('$')
+			idx++
+		case rest[0] == '*':
+			expanded.WriteString(strings.Join(args, " "))
+			usedArgs = true
+			idx++
+		case rest[0] >= '1' && rest[0] <= '9':
+			n, _ := strconv.Atoi(rest[:1])
+			if len(rest) > 1 && rest[1] == '-' {
+				if n <= len(args) {
+					expanded.WriteString(strings.Join(args[n-1:], " "))
+				}
+				idx++
+			} else if n <= len(args) {
+				expanded.WriteString(args[n-1])
+			}
+			usedArgs = true
+			idx++
+		default:
+			// the longest variable name that matches wins
+			name := ""
+			for candidate := range vars {
+				if strings.HasPrefix(rest, candidate) && len(candidate) > len(name) {
+					name = candidate
+				}
+			}
+			if name == "" {
+				expanded.WriteByte('$')
+			} else {
+				expanded.WriteString(vars[name])
+				idx += len(name)
+			}
+		}
+	}
+	return expanded.String(), usedArgs
+}
+
+// context variables available to alias expansions
+func (sm *ServerManager) aliasVars() map[string]string {
+	vars := map[string]string{"nick": "", "channel": "", "server": ""}
+	if sm.current != nil {
+		vars["nick"] = sm.current.Nick
+		vars["server"] = sm.current.Addr
+		if sm.current.currentChannel != nil {
+			vars["channel"] = sm.current.currentChannel.Name
+		}
+	}
+	return vars
+}
+
+// runs each `;` separated command of an alias. The leading slash is optional
+// within an alias. seen holds the aliases already being expanded, so an alias
+// that refers to itself or a built-in of the same name can't loop forever.
+func (sm *ServerManager) runAlias(name string, args string, seen map[string]bool) {
+	commands := expandAlias(sm.config.Aliases[name], strings.Fields(args), sm.aliasVars())
+	nowSeen := map[string]bool{name: true}
+	for alias := range seen {
+		nowSeen[alias] = true
+	}
+	for _, command := range commands {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		if !strings.HasPrefix(command, "/") {
+			command = "/" + command
+		}
+		sm.runInput(command, nowSeen)
+	}
+}
+
+// `/alias name expansion` defines an alias, `/alias name` shows one
+func (sm *ServerManager) addAlias(args string) error {
+	strs := strings.SplitN(args, " ", 2)
+	name := strings.TrimPrefix(strs[0], "/")
+	if name == "" {
+		return errors.New("Usage: /alias <name> <commands>")
+	}
+	if len(strs) < 2 || strings.TrimSpace(strs[1]) == "" {
+		if expansion, ok := sm.config.Aliases[name]; ok {
+			sm.output(RoleItem.Text("/"+name), RoleText.Text(" "+expansion))
+			return nil
+		}
+		return errors.New("No such alias " + name + "!")
+	}
+	sm.config.Aliases[name] = strings.TrimSpace(strs[1])
+	sm.info("Aliased /" + name)
+	return sm.config.Save()
+}
+
+func (sm *ServerManager) removeAlias(args string) error {
+	name := strings.TrimPrefix(strings.TrimSpace(args), "/")
+	if _, ok := sm.config.Aliases[name]; !ok {
+		return errors.New("No such alias " + name + "!")
+	}
+	delete(sm.config.Aliases, name)
+	sm.info("Removed alias /" + name)
+	return sm.config.Save()
+}
+
+func (sm *ServerManager) outputAliases(args string) error {
+	if len(sm.config.Aliases) == 0 {
+		sm.info("No aliases defined")
+		return nil
+	}
+	names := make([]string, 0, len(sm.config.Aliases))
+	for name := range sm.config.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sm.info("All aliases:")
+	for _, name := range names {
+		sm.output(RoleItem.Text("  /"+name), RoleText.Text(" "+sm.config.Aliases[name]))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"reflect"
+	"testing"
+)
+
+func TestExpandAlias(t *testing.T) {
+	vars := map[string]string{"nick": "corgi", "channel": "#go", "server": "irc.example.org:6667"}
+	cases := []struct {
+		expansion string
+		args      []string
+		want      []string
+	}{
+		{"/msg $channel $*", []string{"hello", "there"}, []string{"/msg #go hello there"}},
+		{"/msg $1 $2-", []string{"alice", "how", "are", "you"}, []string{"/msg alice how are you"}},
+		{"/msg $2 $1", []string{"a"}, []string{"/msg  a"}},
+		{"/join", []string{"#go"}, []string{"/join #go"}},
+		{"/join #a; /join", []string{"#b"}, []string{"/join #a", " /join #b"}},
+		{"/msg $nick costs $$5", nil, []string{"/msg corgi costs $5"}},
+		{"/msg $nickserv hi", nil, []string{"/msg corgiserv hi"}},
+		{"/echo $unknown $", nil, []string{"/echo $unknown $"}},
+		{"/msg $channel on $server", nil, []string{"/msg #go on irc.example.org:6667"}},
+		// semicolons in the arguments stay in the arguments
+		{"/msg $channel $*", []string{"hi;", "/quit"}, []string{"/msg #go hi; /quit"}},
+		{"/msg $channel", []string{"hi;/quit"}, []string{"/msg #go hi;/quit"}},
+	}
+	for _, c := range cases {
+		if got := expandAlias(c.expansion, c.args, vars); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("expandAlias(%q, %q) = %q, want %q", c.expansion, c.args, got, c.want)
+		}
+	}
+}
+
+func TestAliasArgumentsCantRunCommands(t *testing.T) {
+	sm, _ := newTestManager(t)
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+
+	input(sm, "/alias greet /msg $channel $*")
+	input(sm, "/greet hi; /quit")
+	c.Expect("PRIVMSG #go :hi; /quit")
+	sm.wait(func() {
+		if !sm.current.Connected {
+			t.Errorf("the alias's arguments ran /quit")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// what /away says when not given a message
+const defaultAwayMessage = "Away"
+
+// the servers /away and /back act on: every connected one with -all,
+// otherwise the current one. Returns the rest of args.
+func (sm *ServerManager) awayServers(args string) ([]*IrcServer, string, error) {
+	args = strings.TrimSpace(args)
+	if args == "-all" || strings.HasPrefix(args, "-all ") {
+		var servers []*IrcServer
+		for _, server := range sm.servers {
+			if server.Connected {
+				servers = append(servers, server)
+			}
+		}
+		if len(servers) == 0 {
+			return nil, "", errors.New("Not connected to any servers!")
+		}
+		return servers, strings.TrimSpace(strings.TrimPrefix(args, "-all")), nil
+	}
+	if sm.current == nil {
+		return nil, "", errors.New("Not on any server!")
+	}
+	if !sm.current.Connected {
+		return nil, "", errors.New("Not connected to " + sm.current.Addr + ", enter `/reconnect` to connect again")
+	}
+	return []*IrcServer{sm.current}, args, nil
+}
+
+// /away [-all] [message] marks us away on the current server, or on all of
+// them
+func (sm *ServerManager) away(args string) error {
+	servers, message, err := sm.awayServers(args)
+	if err != nil {
+		return err
+	}
+	if message == "" {
+		message = defaultAwayMessage
+	}
+	for _, server := range servers {
+		server.SetAway(message)
+	}
+	// we chose to be away, so coming back is up to us too
+	sm.autoAway = nil
+	return nil
+}
+
+// /back [-all] undoes /away
+func (sm *ServerManager) back(args string) error {
+	servers, rest, err := sm.awayServers(args)
+	if err != nil {
+		return err
+	}
+	if rest != "" {
+		return errors.New("Usage: /back [-all]")
+	}
+	for _, server := range servers {
+		server.SetAway("")
+	}
+	sm.autoAway = nil
+	return nil
+}
+
+// starts the auto-away countdown over, since the user just typed something,
+// and brings them back from auto-away if that's where they are
+func (sm *ServerManager) resetIdle() {
+	for _, server := range sm.autoAway {
+		if server.Connected && server.Away {
+			server.SetAway("")
+		}
+	}
+	sm.autoAway = nil
+	if sm.idleTimer != nil {
+		sm.idleTimer.Stop()
+		sm.idleTimer = nil
+	}
+	if sm.config.AutoAway > 0 {
+		sm.idleTimer = time.AfterFunc(time.Duration(sm.config.AutoAway)*time.Minute, func() {
+			sm.post(sm.goIdle)
+		})
+	}
+}
+
+// marks us away everywhere we aren't already, once the user's been idle for
+// the config's auto-away time
+func (sm *ServerManager) goIdle() {
+	message := sm.config.AutoAwayMessage
+	if message == "" {
+		message = defaultAwayMessage
+	}
+	for _, server := range sm.servers {
+		if server.Connected && !server.Away {
+			server.SetAway(message)
+			sm.autoAway = append(sm.autoAway, server)
+		}
+	}
+}
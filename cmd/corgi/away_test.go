@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"testing"
+)
+
+func TestAway(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "alice", "bob")
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+
+	input(sm, "/away gone fishing")
+	c.Expect("AWAY :gone fishing")
+	c.Send(":fake.server 306 corgi :You have been marked as being away")
+	eventually(t, sm, "being marked away", func() bool { return ui.shows("You have been marked as being away") })
+
+	c.Send(":fake.server 301 corgi alice :on holiday")
+	eventually(t, sm, "alice's away reply", func() bool { return ui.shows("alice is away: on holiday") })
+	input(sm, "/nicks")
+	sm.wait(func() {
+		for _, segment := range ui.last {
+			if segment.Text == "alice" && segment.Role != RoleAway {
+				t.Errorf("alice is listed as %+v, want her dimmed", segment)
+			} else if segment.Text == "bob" && segment.Role == RoleAway {
+				t.Errorf("bob is listed as away")
+			}
+		}
+	})
+
+	input(sm, "/back")
+	c.Expect("AWAY")
+	c.Send(":fake.server 305 corgi :You are no longer marked as being away")
+	eventually(t, sm, "coming back", func() bool { return !sm.current.Away })
+}
+
+func TestAutoAway(t *testing.T) {
+	sm, _ := newTestManager(t)
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+
+	// go idle straight away rather than waiting for the timer
+	sm.wait(sm.goIdle)
+	c.Expect("AWAY :Idle")
+	c.Send(":fake.server 306 corgi :You have been marked as being away")
+	eventually(t, sm, "being marked away", func() bool { return sm.current.Away })
+	input(sm, "/nick corgi")
+	c.Expect("AWAY")
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// a built-in command, as in `/join #go`
+type Command struct {
+	Name    string
+	Aliases []string
+	// the arguments it takes, e.g. "<channel> [<key>]"
+	Usage    string
+	Help     string
+	Examples []string
+	// how many space separated arguments it takes, MaxArgs -1 for any number
+	MinArgs int
+	MaxArgs int
+	// whether it acts on the current server, so it's refused without one
+	NeedsServer bool
+	Run         func(sm *ServerManager, args string) error
+}
+
+// every built-in command, in the order /help lists them. Filled in by init,
+// since /help needs to refer to it.
+var commands []*Command
+
+// commands by name and alias
+var commandIndex map[string]*Command
+
+func init() {
+	commands = []*Command{
+		{Name: "msg", Usage: "<target> <text>", MinArgs: 2, MaxArgs: -1, NeedsServer: true,
+			Help:     "Sends a message to a channel or nick.",
+			Examples: []string{"/msg #go hello everyone", "/msg alice are you around?"},
+			Run:      (*ServerManager).message},
+		{Name: "me", Usage: "<action>", MinArgs: 1, MaxArgs: -1, NeedsServer: true,
+			Help:     "Does an action in the current channel.",
+			Examples: []string{"/me waves"},
+			Run:      (*ServerManager).action},
+		{Name: "notice", Usage: "<target> <text>", MinArgs: 2, MaxArgs: -1, NeedsServer: true,
+			Help: "Sends a notice, which clients and bots never answer automatically.",
+			Run:  (*ServerManager).notice},
+		{Name: "join", Aliases: []string{"j"}, Usage: "<channel>[,<channel>...] [<key>[,<key>...]]", MinArgs: 1, MaxArgs: 2, NeedsServer: true,
+			Help:     "Joins channels, with keys in the same order for the ones that need them.",
+			Examples: []string{"/join #go", "/join #secret,#go hunter2"},
+			Run:      (*ServerManager).joinChannel},
+		{Name: "part", Aliases: []string{"leave"}, Usage: "[<channel>]", MaxArgs: 1, NeedsServer: true,
+			Help: "Leaves a channel, the current one by default.",
+			Run:  (*ServerManager).partChannel},
+		{Name: "channel", Usage: "<channel>", MinArgs: 1, MaxArgs: 1, NeedsServer: true,
+			Help: "Switches to a channel you're on.",
+			Run:  (*ServerManager).switchChannel},
+		{Name: "channels", Help: "Lists the channels you're on on the current server.", NeedsServer: true,
+			Run: (*ServerManager).outputChannels},
+		{Name: "nicks", Aliases: []string{"names"}, Usage: "[<channel>]", MaxArgs: 1, NeedsServer: true,
+			Help: "Lists who's on a channel, the current one by default. Away users are dimmed.",
+			Run:  (*ServerManager).outputNicks},
+		{Name: "nick", Usage: "<nick>", MinArgs: 1, MaxArgs: 1, NeedsServer: true,
+			Help: "Changes your nick on the current server.",
+			Run:  (*ServerManager).setNick},
+		{Name: "away", Usage: "[-all] [<message>]", MaxArgs: -1,
+			Help: "Marks you away on the current server, or on all of them with -all.",
+			Run:  (*ServerManager).away},
+		{Name: "back", Usage: "[-all]", MaxArgs: 1,
+			Help: "Marks you as back on the current server, or on all of them with -all.",
+			Run:  (*ServerManager).back},
+		{Name: "connect", Usage: "[-tls] [-4|-6] [-bind <address>] [-proxy <url>] <host> [<port>]", MinArgs: 1, MaxArgs: -1,
+			Help: "Connects to a server, on port 6667 by default or 6697 with TLS, or to a network from the config by name. " +
+				"The host can be host:port, [v6]:port, or an irc:// or ircs:// URL, which may name a channel to join. " +
+				"-4 and -6 try IPv4 or IPv6 addresses first, -bind sets the local address to connect from. " +
+				"The config's password, perform list, channels and proxy for it are used. " +
+				"Proxies are socks5:// or http:// URLs, with a user:password@ if they need one.",
+			Examples: []string{"/connect irc.libera.chat", "/connect localhost:6668", "/connect libera",
+				"/connect ircs://irc.libera.chat/#go", "/connect -6 [2001:db8::1]:6667",
+				"/connect -tls -proxy socks5://localhost:1080 irc.libera.chat"},
+			Run: (*ServerManager).newServer},
+		{Name: "server", Usage: "<host:port>", MinArgs: 1, MaxArgs: 1,
+			Help: "Switches to another server you're connected to.",
+			Run:  (*ServerManager).switchServer},
+		{Name: "servers", Help: "Lists the servers you're connected to.",
+			Run: (*ServerManager).outputServers},
+		{Name: "disconnect", Usage: "[-keep] [<host:port>] [<message>]", MaxArgs: -1,
+			Help: "Quits a server, the current one by default. With -keep it stays in the list to /reconnect to later.",
+			Run:  (*ServerManager).disconnectServer},
+		{Name: "reconnect", Usage: "[<host:port>]", MaxArgs: 1,
+			Help: "Connects again to a server you were disconnected from.",
+			Run:  (*ServerManager).reconnectServer},
+		{Name: "quit", Aliases: []string{"exit"}, Usage: "[<message>]", MaxArgs: -1,
+			Help: "Quits every server and closes corgi.",
+			Run:  (*ServerManager).quitAll},
+		{Name: "mentions", Usage: "[<number>|clear]", MaxArgs: 1,
+			Help: "Lists your highlights on every server. With a number from the list, goes to the channel it was in.",
+			Run:  (*ServerManager).outputMentions},
+		{Name: "ignore", Usage: "[<mask> [<types>] [-channel <channel>] [-for <duration>]]", MaxArgs: -1,
+			Help: "Hides messages from people matching a mask, optionally only some types of message, " +
+				"in one channel or for a while. Without arguments, lists the ignores.",
+			Examples: []string{"/ignore spammer", "/ignore *!*@example.org join,part -channel #go -for 2h"},
+			Run:      (*ServerManager).addIgnore},
+		{Name: "unignore", Usage: "<mask or number>", MinArgs: 1, MaxArgs: 1,
+			Help: "Stops ignoring someone, by their mask or number from /ignore.",
+			Run:  (*ServerManager).removeIgnore},
+		{Name: "alias", Usage: "<name> [<commands>]", MinArgs: 1, MaxArgs: -1,
+			Help: "Defines a command standing for others, separated by ;. $1, $2... and $* are its arguments, " +
+				"$nick, $channel and $server where you are. Without commands, shows the alias.",
+			Examples: []string{"/alias hi /msg $channel hello $*", "/alias work /join #team; /join #ops"},
+			Run:      (*ServerManager).addAlias},
+		{Name: "unalias", Usage: "<name>", MinArgs: 1, MaxArgs: 1,
+			Help: "Removes an alias.",
+			Run:  (*ServerManager).removeAlias},
+		{Name: "aliases", Help: "Lists your aliases.",
+			Run: (*ServerManager).outputAliases},
+		{Name: "script", Usage: "load|unload|reload <name> | list", MinArgs: 1, MaxArgs: 2,
+			Help: "Manages Lua scripts, which are looked up in the plugins directory by name.",
+			Run:  (*ServerManager).scriptCmd},
+		{Name: "queue", Usage: "[cancel [<number>]]", MaxArgs: 2, NeedsServer: true,
+			Help: "Lists what's waiting to be sent to the current server because of flood protection, or cancels some or all of it.",
+			Run:  (*ServerManager).outputQueue},
+		{Name: "paste", Usage: "[cancel]", MaxArgs: 1,
+			Help: "Sends a multi-line paste that's waiting to be confirmed, or throws it away.",
+			Run:  (*ServerManager).confirmPaste},
+		{Name: "quote", Aliases: []string{"raw"}, Usage: "<line>", MinArgs: 1, MaxArgs: -1, NeedsServer: true,
+			Help:     "Sends a line to the current server as it is, for commands corgi doesn't know.",
+			Examples: []string{"/quote WHOIS alice", "/quote MODE #go +m"},
+			Run:      (*ServerManager).quote},
+		{Name: "debug", Usage: "[on|off]", MaxArgs: 1, NeedsServer: true,
+			Help: "Shows every line sent to and from the current server, with passwords hidden, in place of the channel.",
+			Run:  (*ServerManager).debugCmd},
+		{Name: "theme", Usage: "[<name>]", MaxArgs: 1,
+			Help: "Switches theme, or lists the themes there are.",
+			Run:  (*ServerManager).setTheme},
+		{Name: "help", Aliases: []string{"?"}, Usage: "[<command>]", MaxArgs: 1,
+			Help: "Lists the commands, or explains one.",
+			Run:  (*ServerManager).outputHelp},
+	}
+	commandIndex = make(map[string]*Command)
+	for _, cmd := range commands {
+		commandIndex[cmd.Name] = cmd
+		for _, alias := range cmd.Aliases {
+			commandIndex[alias] = cmd
+		}
+	}
+}
+
+// the command's name and arguments, as in "/join <channel>"
+func (cmd *Command) usageLine() string {
+	if cmd.Usage == "" {
+		return "/" + cmd.Name
+	}
+	return "/" + cmd.Name + " " + cmd.Usage
+}
+
+// checks the number of arguments, so commands needn't all do it themselves
+func (cmd *Command) checkArgs(args string) error {
+	count := len(strings.Fields(args))
+	if count < cmd.MinArgs || (cmd.MaxArgs >= 0 && count > cmd.MaxArgs) {
+		return errors.New("Usage: " + cmd.usageLine())
+	}
+	return nil
+}
+
+// /help lists the commands, /help <command> describes one
+func (sm *ServerManager) outputHelp(args string) error {
+	name := strings.TrimPrefix(strings.TrimSpace(args), "/")
+	if name == "" {
+		sm.info("All commands, enter `/help <command>` for more on one:")
+		for _, cmd := range commands {
+			sm.output(RoleItem.Text("  "+cmd.usageLine()), RoleNote.Text("  "+cmd.Help))
+		}
+		var others []string
+		for alias := range sm.config.Aliases {
+			others = append(others, "/"+alias)
+		}
+		for _, script := range sm.scripts {
+			for command := range script.commands {
+				others = append(others, "/"+command)
+			}
+		}
+		if len(others) > 0 {
+			sort.Strings(others)
+			sm.info("From your aliases and scripts: " + strings.Join(others, " "))
+		}
+		if sm.editsInput() {
+			sm.info("Up and Down browse what you've typed, Tab completes, and Ctrl+B, Ctrl+T, Ctrl+U, Ctrl+R, Ctrl+K and Ctrl+O type bold, italic, underline, reverse, color and reset codes.")
+		} else {
+			sm.info("Input history, completion and the formatting keys need `-ui line` on a terminal.")
+		}
+		return nil
+	}
+	if cmd := commandIndex[name]; cmd != nil {
+		sm.output(RoleInfo.Text("Usage: "), RoleItem.Text(cmd.usageLine()))
+		sm.output(RoleText.Text(cmd.Help))
+		if len(cmd.Aliases) > 0 {
+			sm.output(RoleInfo.Text("Also: "), RoleItem.Text("/"+strings.Join(cmd.Aliases, " /")))
+		}
+		if len(cmd.Examples) > 0 {
+			sm.info("Examples:")
+			for _, example := range cmd.Examples {
+				sm.output(RoleItem.Text("  " + example))
+			}
+		}
+		return nil
+	}
+	if expansion, ok := sm.config.Aliases[name]; ok {
+		sm.output(RoleInfo.Text("/"+name+" is an alias for "), RoleItem.Text(expansion))
+		return nil
+	}
+	if script, _ := sm.scriptCommand(name); script != nil {
+		sm.info("/" + name + " comes from the script " + script.name)
+		return nil
+	}
+	return errors.New("No such command " + name + "! Enter `/help` for a list of commands.")
+}
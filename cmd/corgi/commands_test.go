@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHelp(t *testing.T) {
+	sm, ui := newTestManager(t)
+	sm.wait(func() {
+		sm.config.Aliases["hi"] = "/msg $channel hello"
+		sm.processCommand("help", "")
+		for _, cmd := range commands {
+			if !ui.shows(cmd.usageLine()) {
+				t.Errorf("/help doesn't list %s", cmd.Name)
+			}
+		}
+		if !ui.shows("From your aliases and scripts: /hi") {
+			t.Errorf("/help doesn't mention aliases")
+		}
+		// testUi, like PaneUi, doesn't edit the input line
+		if !ui.shows("need `-ui line`") {
+			t.Errorf("/help doesn't say where the editing keys are")
+		}
+
+		ui.lines = nil
+		sm.processCommand("help", "/j")
+		if !ui.shows("Usage: /join <channel>") || !ui.shows("/join #go") {
+			t.Errorf("/help j shows %q", ui.lines)
+		}
+		sm.processCommand("help", "hi")
+		if !ui.shows("/hi is an alias for /msg $channel hello") {
+			t.Errorf("/help hi shows %q", ui.lines)
+		}
+	})
+}
+
+func TestCommandArgs(t *testing.T) {
+	sm, ui := newTestManager(t)
+	tests := []struct {
+		input, want string
+	}{
+		{"/nick", "Usage: /nick <nick>"},
+		{"/nick a b", "Usage: /nick <nick>"},
+		{"/channels extra", "Usage: /channels"},
+		{"/bogus", "bogus is an unrecognized command!"},
+	}
+	for _, test := range tests {
+		input(sm, test.input)
+		sm.wait(func() {
+			if !ui.shows(test.want) {
+				t.Errorf("%s shows %q, want %q", test.input, ui.lines, test.want)
+			}
+			ui.lines = nil
+		})
+	}
+}
+
+func TestCommandsNeedingServer(t *testing.T) {
+	sm, ui := newTestManager(t)
+	for _, line := range []string{"/part", "/part #go", "/nicks", "/channels", "/channel #go", "/join #go",
+		"/me waves", "/msg #go hi", "/notice #go hi", "/nick corgi", "/queue", "/quote PING", "/debug"} {
+		input(sm, line)
+		sm.wait(func() {
+			if !ui.shows("Not on any server!") {
+				t.Errorf("%s with no server shows %q", line, ui.lines)
+			}
+			ui.lines = nil
+		})
+	}
+}
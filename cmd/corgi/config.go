@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/natemealey/corgi/irc"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// where corgi keeps its files, e.g. ~/.config/corgi/history.json
+func configPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "corgi", name)
+}
+
+// user settings, saved as JSON whenever they're changed from inside corgi
+type Config struct {
+	path string
+	// why the file couldn't be loaded, if it couldn't. Saving over it would
+	// lose whatever the user had in it, so we don't.
+	loadErr error
+	Aliases map[string]string `json:"aliases"`
+	Ignores []Ignore          `json:"ignores"`
+	// flood protection: how many lines can be sent at once, then how many
+	// lines per second after that
+	FloodBurst int     `json:"flood_burst"`
+	FloodRate  float64 `json:"flood_rate"`
+	// seconds between our PINGs, and how long to wait for an answer before
+	// giving up on the connection. 0 turns either off.
+	PingInterval int `json:"ping_interval"`
+	PingTimeout  int `json:"ping_timeout"`
+	// seconds to wait before reconnecting a dropped connection, doubling
+	// after each failed attempt. 0 turns reconnecting off.
+	ReconnectDelay int `json:"reconnect_delay"`
+	// pastes with more lines than this need confirming, 0 to never ask. Only
+	// the line front-end can tell a paste from lines typed one by one.
+	PasteThreshold int `json:"paste_threshold"`
+	// show mIRC bold, colors and so on as plain text instead of styling it
+	StripFormatting bool `json:"strip_formatting"`
+	// the theme to draw with, bundled or from the themes directory
+	Theme string `json:"theme"`
+	// how to show the time lines in channels and private messages arrived,
+	// as a Go time layout like "15:04". Empty leaves timestamps out.
+	TimestampFormat string `json:"timestamp_format"`
+	// the styles nicks are colored with, picked by a hash of the nick so each
+	// always gets the same one. Left out, it's every color the theme doesn't
+	// use for something else; an empty list turns nick coloring off.
+	NickColors []string `json:"nick_colors"`
+	// styles for particular nicks instead of their hashed one
+	NickColorOverrides map[string]string `json:"nick_color_overrides"`
+	// how to notify about highlights, private messages and keywords: any of
+	// bell, osc9, osc777 and command. Empty turns notifications off.
+	Notify []string `json:"notify"`
+	// what the command notifier runs, given the title and message as two
+	// more arguments, e.g. ["notify-send"]
+	NotifyCommand []string `json:"notify_command"`
+	// words that notify when anyone says them, besides our nick
+	NotifyKeywords []string `json:"notify_keywords"`
+	// the fewest seconds between notifications, so a busy channel doesn't
+	// bury the user in them
+	NotifyInterval int `json:"notify_interval"`
+	// what makes a message a highlight, and rules for particular channels
+	// to use instead
+	Highlights        HighlightRules            `json:"highlights"`
+	ChannelHighlights map[string]HighlightRules `json:"channel_highlights"`
+	// minutes without input before marking us away on every server, 0 to
+	// never do it, and the away message to use
+	AutoAway        int    `json:"auto_away"`
+	AutoAwayMessage string `json:"auto_away_message"`
+	// settings for particular networks, by a name to /connect to or by
+	// host:port
+	Networks map[string]Network `json:"networks"`
+}
+
+// loads the config at path. A missing file isn't an error, it just means
+// everything is at its default.
+func LoadConfig(path string) (*Config, error) {
+	config := Config{
+		path:       path,
+		FloodBurst: irc.DefaultFloodBurst,
+		FloodRate:  irc.DefaultFloodRate,
+		// as many lines as go out in one flood protection burst
+		PasteThreshold:  irc.DefaultFloodBurst,
+		PingInterval:    int(irc.DefaultPingInterval / time.Second),
+		PingTimeout:     int(irc.DefaultPingTimeout / time.Second),
+		ReconnectDelay:  int(irc.DefaultReconnectDelay / time.Second),
+		Theme:           "default",
+		NotifyInterval:  10,
+		AutoAwayMessage: "Idle"}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &config)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if config.Aliases == nil {
+		config.Aliases = make(map[string]string)
+	}
+	config.loadErr = err
+	return &config, err
+}
+
+func (config *Config) Save() error {
+	if config.loadErr != nil {
+		return errors.New("Not saving over " + config.path + ", since it failed to load! Fix it and restart corgi to keep changes.")
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(config.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(config.path, data, 0600)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigNotSavedAfterLoadError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	broken := `{"aliases": {"hi": "/msg $channel hi"}, "networks": {`
+	if err := os.WriteFile(path, []byte(broken), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err == nil {
+		t.Fatalf("loading malformed JSON should fail")
+	}
+	config.Aliases["bye"] = "/quit"
+	if err := config.Save(); err == nil {
+		t.Errorf("saving a config that failed to load should fail")
+	}
+	if data, _ := os.ReadFile(path); string(data) != broken {
+		t.Errorf("the config file was overwritten with %s", data)
+	}
+
+	// a missing file is fine to save
+	path = filepath.Join(t.TempDir(), "corgi", "config.json")
+	if config, err = LoadConfig(path); err != nil {
+		t.Fatalf("a missing config should load as the defaults: %v", err)
+	}
+	config.Aliases["bye"] = "/quit"
+	if err := config.Save(); err != nil {
+		t.Errorf("failed to save: %v", err)
+	}
+	if config, err = LoadConfig(path); err != nil || config.Aliases["bye"] != "/quit" {
+		t.Errorf("the saved alias didn't load back: %v", err)
+	}
+}
@@ -0,0 +1,962 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/natemealey/corgi/irc"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// corgi's side of a server: the session from the irc package, plus which of
+// its channels is on screen and what's been shown in each of them
+type IrcServer struct {
+	*irc.Server
+	currentChannel *irc.Channel
+	logs           map[string][][]Segment // by channel name
+	// messages in channels that aren't on screen since they last were, and
+	// how many of them were highlights, by channel name
+	unread      map[string]int
+	highlighted map[string]int
+	// whether every line to and from the server is being recorded, the
+	// recording, and whether it's on screen instead of the current channel
+	debug      bool
+	debugLog   [][]Segment
+	debugShown bool
+	// the config's settings for the network, if it has any
+	network *Network
+}
+
+// how many lines of each channel are kept to show again when switching back
+const maxLogLines = 1000
+
+// when we leave the current channel, select the most recently used of the
+// rest. Assumes the current channel was already removed.
+func (ic *IrcServer) selectNextChannel() {
+	var nextChannel *irc.Channel
+	for _, channel := range ic.Channels {
+		if nextChannel == nil || channel.UpdateTime.After(nextChannel.UpdateTime) {
+			nextChannel = channel
+		}
+	}
+	ic.currentChannel = nextChannel
+	if ic.currentChannel != nil {
+		ic.currentChannel.UpdateTime = time.Now()
+	}
+}
+
+// how a PRIVMSG from sender to recipient looks
+func (sm *ServerManager) messageLine(ic *IrcServer, sender string, recipient string, msg string, highlight bool) []Segment {
+	if sender == "" {
+		sender = ic.Nick
+	}
+	from := sm.nickText(ic, sender, "<"+sender+"> ")
+	if strings.HasPrefix(msg, "\x01ACTION ") {
+		from = sm.nickText(ic, sender, "* "+sender+" ")
+		msg = strings.TrimSuffix(strings.TrimPrefix(msg, "\x01ACTION "), "\x01")
+	}
+	line := []Segment{RoleChannel.Text(recipient + " "), from}
+	if !irc.IsChannel(recipient) {
+		line = append(line, RolePrivate.Text("[private] "))
+	}
+	if highlight {
+		return append(line, sm.formatText(msg, RoleHighlight.Text(""))...)
+	}
+	text := sm.colorMentions(ic, ic.Channels[recipient], sm.formatText(msg, RoleText.Text("")))
+	return append(line, text...)
+}
+
+// human explanations of the numerics a server may send in reply to a JOIN
+var joinErrors = map[string]string{
+	"405": "you have joined too many channels",
+	"471": "the channel is full (+l)",
+	"473": "the channel is invite only (+i), you need an invite first",
+	"474": "you are banned from the channel (+b)",
+	"475": "wrong or missing channel key (+k), try `/join <channel> <key>`",
+	"477": "you need a registered and identified nick to join",
+}
+
+// container of all our IRC server metadata. Everything in it, including the
+// UI and the servers, belongs to the goroutine running the event loop; other
+// goroutines hand it work with post.
+type ServerManager struct {
+	servers []*IrcServer
+	current *IrcServer            // current socket
+	closed  map[string]*IrcServer // disconnected and taken off the list, by socket
+	ui      Ui
+	config  *Config
+	theme   Theme
+	// parsed from the config's nick colors
+	nickColors nickColors
+	notifiers  []Notifier
+	highlights highlighters
+	// every highlight on every server, oldest first
+	mentions []mention
+	// counts down to auto-away from the last input, and the servers it
+	// marked us away on
+	idleTimer *time.Timer
+	autoAway  []*IrcServer
+	// when notifiers were last used, for rate limiting them
+	lastNotified time.Time
+	scripts      map[string]*Script // by name
+	// multi-line input waiting for the user to confirm it with /paste
+	pendingPaste []string
+	loop         *irc.Loop
+}
+
+func NewServerManager(ui Ui) *ServerManager {
+	var sm ServerManager
+	sm.loop = irc.NewLoop()
+	sm.closed = make(map[string]*IrcServer)
+	// prepare for program termination
+	sm.handleTermination()
+	sm.ui = ui
+	// completion happens on the input goroutine, so look up candidates on the
+	// event loop rather than reading its state directly
+	if sm.editsInput() {
+		sm.ui.(editingUi).SetCompleter(NewCompleter(func(word string, lineStart bool) (candidates []string) {
+			sm.wait(func() { candidates = sm.completionCandidates(word, lineStart) })
+			return candidates
+		}))
+	}
+	config, err := LoadConfig(configPath("config.json"))
+	if err != nil {
+		sm.err("Failed to load config, using defaults and not saving changes. Error is: " + err.Error())
+	}
+	sm.config = config
+	if sm.theme, err = LoadTheme(config.Theme); err != nil {
+		sm.err("Failed to load theme, using the default. Error is: " + err.Error())
+		sm.theme = bundledThemes["default"]
+	}
+	sm.loadNickColors()
+	sm.loadNotifiers()
+	sm.loadHighlights()
+	sm.scripts = make(map[string]*Script)
+	sm.loadScripts()
+	sm.resetIdle()
+	return &sm
+}
+
+// Must be called on program exit to clean up after UI
+func (sm *ServerManager) Close() {
+	sm.ui.Close()
+}
+
+// queues fn to run on the event loop, updating the prompt afterwards
+func (sm *ServerManager) post(fn func()) {
+	sm.loop.Post(func() {
+		fn()
+		if !sm.loop.Stopped() {
+			sm.updatePrompt()
+		}
+	})
+}
+
+// runs fn on the event loop and waits for it to finish. Calling this from
+// the event loop itself would deadlock.
+func (sm *ServerManager) wait(fn func()) {
+	done := make(chan bool)
+	sm.post(func() {
+		fn()
+		close(done)
+	})
+	<-done
+}
+
+// the event loop: runs everything posted to it, one at a time, until stopped
+func (sm *ServerManager) run() {
+	sm.updatePrompt()
+	sm.loop.Run()
+}
+
+// reads user input until the UI dies. This blocks, so it runs in its own
+// goroutine and leaves handling the input to the event loop.
+func (sm *ServerManager) readInput() {
+	for input := range sm.ui.Input() {
+		sm.post(func() { sm.handleUserInput(input) })
+	}
+	sm.post(sm.loop.Stop)
+}
+
+// updates the prompt and status line to match the current server and channel
+func (sm *ServerManager) updatePrompt() {
+	if sm.current != nil {
+		channel := "[no channel]"
+		if sm.current.currentChannel != nil {
+			channel = sm.current.currentChannel.Name
+			sm.ui.SetBuffer(bufferName(sm.current.Addr, channel))
+		} else {
+			sm.ui.SetBuffer(bufferName(sm.current.Addr, ""))
+		}
+		nick := sm.current.Nick
+		if nick == "" {
+			nick = "[no nick]"
+		}
+		sm.ui.SetPrompt(sm.theme.apply([]Segment{
+			RoleChannel.Text(channel + " "), RoleOwnNick.Text(nick), RolePrompt.Text("> ")})...)
+		status := []Segment{RoleStatus.Text(sm.current.Addr)}
+		if !sm.current.Connected {
+			status = append(status, RoleError.Text(" [disconnected]"))
+		} else if lag := lagString(sm.current); lag != "" {
+			status = append(status, RoleStatus.Text(" [lag "+lag+"]"))
+		}
+		if sm.current.debugShown {
+			status = append(status, RoleStatus.Text(" [debug]"))
+		}
+		status = append(status, sm.current.activity()...)
+		sm.ui.SetStatus(sm.theme.apply(status)...)
+	} else {
+		sm.ui.SetBuffer("")
+		sm.ui.SetPrompt(sm.theme.apply([]Segment{RolePrompt.Text("> ")})...)
+		sm.ui.SetStatus(sm.theme.apply([]Segment{RoleStatus.Text("[not on any server]")})...)
+	}
+}
+
+// a short display of the lag, empty until it's been measured
+func lagString(ic *IrcServer) string {
+	lag := ic.Lag
+	if wait := ic.PingWait(); wait > lag {
+		// a PING that's taking longer than the last one is the better estimate
+		lag = wait
+	}
+	if lag == 0 {
+		return ""
+	}
+	return lag.Round(10 * time.Millisecond).String()
+}
+
+// segments with the time in front, if the config asks for timestamps
+func (sm *ServerManager) stamp(segments []Segment) []Segment {
+	if sm.config.TimestampFormat == "" {
+		return segments
+	}
+	stamp := RoleTimestamp.Text(time.Now().Format(sm.config.TimestampFormat) + " ")
+	return append([]Segment{stamp}, segments...)
+}
+
+// shows a line belonging to channelName on ic if that's the channel on
+// screen, and keeps it to show again when switching back to the channel
+func (sm *ServerManager) show(ic *IrcServer, channelName string, segments ...Segment) {
+	segments = sm.stamp(segments)
+	if ic.Channels[channelName] != nil {
+		logs := append(ic.logs[channelName], segments)
+		if len(logs) > maxLogLines {
+			logs = logs[len(logs)-maxLogLines:]
+		}
+		ic.logs[channelName] = logs
+	}
+	if sm.onScreen(ic, channelName) {
+		sm.output(segments...)
+	}
+}
+
+// whether channelName on ic is the channel being shown
+func (sm *ServerManager) onScreen(ic *IrcServer, channelName string) bool {
+	return sm.current == ic && !ic.debugShown && ic.currentChannel != nil && ic.currentChannel.Name == channelName
+}
+
+// shows a PRIVMSG, private ones whichever channel is on screen. Highlights
+// are drawn differently and kept for /mentions.
+func (sm *ServerManager) showMessage(ic *IrcServer, sender, recipient, text string, highlight bool) {
+	line := sm.messageLine(ic, sender, recipient, text, highlight)
+	target := recipient
+	if irc.IsChannel(recipient) {
+		if !sm.onScreen(ic, recipient) && ic.Channels[recipient] != nil {
+			ic.countUnread(recipient, highlight)
+		}
+		sm.show(ic, recipient, line...)
+	} else {
+		target = sender
+		sm.output(sm.stamp(line)...)
+	}
+	if highlight {
+		sm.addMention(ic, target, line)
+	}
+}
+
+// clears the screen and shows what's been said in the current channel,
+// which is then no longer unread, or the debug buffer if that's shown
+func (sm *ServerManager) redraw() {
+	sm.ui.Clear()
+	if sm.current != nil && sm.current.debugShown {
+		for _, line := range sm.current.debugLog {
+			sm.output(line...)
+		}
+	} else if sm.current != nil && sm.current.currentChannel != nil {
+		channelName := sm.current.currentChannel.Name
+		for _, line := range sm.current.logs[channelName] {
+			sm.output(line...)
+		}
+		delete(sm.current.unread, channelName)
+		delete(sm.current.highlighted, channelName)
+	}
+}
+
+// we're no longer on channelName, so move on from it if it's on screen
+func (sm *ServerManager) leftChannel(ic *IrcServer, channelName string) {
+	delete(ic.logs, channelName)
+	delete(ic.unread, channelName)
+	delete(ic.highlighted, channelName)
+	if ic.currentChannel != nil && ic.currentChannel.Name == channelName {
+		ic.selectNextChannel()
+		if sm.current == ic {
+			sm.redraw()
+		}
+	}
+}
+
+// runs for every event on ic, scripts first
+func (sm *ServerManager) receiveEvent(ic *IrcServer, ev *irc.Event) {
+	if ev.Raw == "" {
+		sm.handleConnectionEvent(ic, ev)
+	} else if !sm.scriptMessageHooks("message", ic, ev) {
+		sm.handleEvent(ic, ev)
+		sm.scriptMessageHooks("after_message", ic, ev)
+	}
+}
+
+func (sm *ServerManager) handleConnectionEvent(ic *IrcServer, ev *irc.Event) {
+	switch ev.Command {
+	case irc.Connected:
+		sm.success("Connected to " + ic.Addr)
+	case irc.Registered:
+		sm.perform(ic)
+	case irc.Disconnected:
+		// otherwise we hung up ourselves, and whoever did has said so
+		if ev.Err != nil {
+			sm.warn("Disconnected from " + ic.Addr + ": " + ev.Err.Error())
+		}
+	case irc.Reconnecting:
+		if ev.Err != nil {
+			sm.err("Failed to reconnect to " + ic.Addr + "! Error is: " + ev.Err.Error())
+		}
+		sm.note("Reconnecting to " + ic.Addr + " in " + ev.Delay.String() + "...")
+	}
+}
+
+// shows a line from ic. The irc package has already updated the session by
+// the time this runs, so e.g. a channel we've parted is already gone.
+func (sm *ServerManager) handleEvent(ic *IrcServer, ev *irc.Event) {
+	// TODO handle taken nick
+	channelName := ev.Param(0)
+	sender := ev.Nick()
+	message := ev.Text()
+	// ignored users still change channel state, they just aren't shown
+	scope := channelName
+	if ev.Command == "INVITE" {
+		// the nick invited, then the channel
+		scope = ev.Param(1)
+	}
+	ignored := sm.isIgnored(ev.Prefix, messageType(ev.Command, message), scope)
+	isCurrent := sm.current == ic && ev.Channel != nil && ev.Channel == ic.currentChannel && !ignored
+	switch ev.Command {
+	case "JOIN":
+		if ev.Self {
+			ic.currentChannel = ev.Channel
+			ic.currentChannel.UpdateTime = time.Now()
+			if sm.current == ic {
+				sm.redraw()
+			}
+		}
+		if !ignored {
+			sm.show(ic, channelName, sm.nickText(ic, sender, sender), RoleJoinPart.Text(" has joined "+channelName))
+		}
+	case "PART":
+		if !ignored {
+			sm.show(ic, channelName, sm.nickText(ic, sender, sender), RoleJoinPart.Text(" has parted "+channelName))
+		}
+		if ev.Self {
+			sm.leftChannel(ic, channelName)
+		}
+	case "PRIVMSG":
+		if !ignored {
+			highlight := !ev.Self && sm.isHighlight(ic, ev.Prefix, channelName, message)
+			sm.showMessage(ic, sender, channelName, message, highlight)
+			if !ev.Self {
+				sm.notifyMessage(ic, sender, channelName, message, highlight)
+			}
+		}
+	case "NOTICE":
+		if ignored {
+			break
+		}
+		line := []Segment{RoleChannel.Text(channelName + " "), sm.nickText(ic, sender, "-"+sender+"- ")}
+		line = append(line, sm.formatText(message, RoleText.Text(""))...)
+		if irc.IsChannel(channelName) {
+			sm.show(ic, channelName, line...)
+		} else {
+			sm.output(sm.stamp(line)...)
+		}
+	case "INVITE":
+		if !ignored {
+			sm.note(sender + " invited you to " + ev.Param(1) + ", enter `/join " + ev.Param(1) + "` to accept")
+		}
+	case "QUIT":
+		for _, channel := range ev.Channels {
+			if !sm.isIgnored(ev.Prefix, "QUIT", channel.Name) {
+				sm.show(ic, channel.Name, sm.nickText(ic, sender, sender), RoleJoinPart.Text(" has quit."))
+			}
+		}
+	case "NICK":
+		newNick := channelName
+		if ev.Self {
+			sm.note("Your nickname is now " + newNick)
+		}
+		for _, channel := range ev.Channels {
+			if !ev.Self && !sm.isIgnored(ev.Prefix, "NICK", channel.Name) {
+				sm.show(ic, channel.Name, sm.nickText(ic, sender, sender),
+					RoleJoinPart.Text(" is now known as "), sm.nickText(ic, newNick, newNick))
+			}
+		}
+	case "KICK":
+		// args are the channel, the victim, then the reason
+		if ev.Channel == nil {
+			break
+		}
+		victim := ev.Param(1)
+		if victim == ic.Nick {
+			sm.leftChannel(ic, channelName)
+			sm.note("You have been kicked from " + channelName + " by " + sender)
+		} else if !ignored {
+			sm.show(ic, channelName, sm.nickText(ic, victim, victim),
+				RoleJoinPart.Text(" was kicked from "+channelName+" by "), sm.nickText(ic, sender, sender))
+		}
+	case "470": // forwarded to another channel
+		// args are our nick, the requested channel, then the target channel
+		if len(ev.Params) > 2 {
+			sm.warn(ev.Param(1) + " forwarded you to " + ev.Param(2))
+		}
+	case "403": // no such channel, in reply to a JOIN, PART, MODE or TOPIC
+		sm.err("No such channel " + ev.Param(1))
+	case "405", "471", "473", "474", "475", "477": // JOIN failures
+		sm.err("Cannot join " + ev.Param(1) + ": " + joinErrors[ev.Command])
+	case "305", "306": // no longer or now marked away
+		sm.note(ev.Text() + " on " + ic.Addr)
+	case "301": // away reply: our nick, their nick, then their message
+		sm.note(ev.Param(1) + " is away: " + stripFormatting(ev.Param(2)))
+	case "PING", "PONG", "001", "396", "AWAY":
+	case "352", "315": // WHO reply and its end, which we ask for to learn who's away
+	case "353": // list of nicks
+	case "366": // End of nicks
+	case "375": // MOTD start
+	case "372": // MOTD body
+	case "376": // MOTD end
+	default:
+		// TODO make sure blank channel should always be output
+		if (isCurrent || channelName == "") && len(ev.Params) > 0 {
+			sm.note(stripFormatting(strings.Join(ev.Params[1:], " ")))
+		}
+	}
+}
+
+// the IrcServer for a server we're about to connect to, using the config's
+// settings and reporting everything that happens on it to the event loop
+func (sm *ServerManager) newIrcServer(socket string, nick string, user string, real string) *IrcServer {
+	ic := &IrcServer{
+		Server:      irc.NewServer(socket, nick, user, real),
+		logs:        make(map[string][][]Segment),
+		unread:      make(map[string]int),
+		highlighted: make(map[string]int)}
+	ic.FloodBurst = sm.config.FloodBurst
+	ic.FloodRate = sm.config.FloodRate
+	ic.PingInterval = time.Duration(sm.config.PingInterval) * time.Second
+	ic.PingTimeout = time.Duration(sm.config.PingTimeout) * time.Second
+	ic.ReconnectDelay = time.Duration(sm.config.ReconnectDelay) * time.Second
+	// so we hear when people go away and come back
+	ic.Caps = []string{"away-notify"}
+	ic.Trace = func(line string, outgoing bool) { sm.traceLine(ic, line, outgoing) }
+	ic.Dispatch = sm.post
+	ic.Handle(irc.AnyCommand, func(ev *irc.Event) { sm.receiveEvent(ic, ev) })
+	return ic
+}
+
+// Adds a connection to the manager and sets it as the current server
+func (sm *ServerManager) addConnection(socket string, nick string, user string, real string, network *Network) (*IrcServer, bool) {
+	ic := sm.newIrcServer(socket, nick, user, real)
+	if network != nil {
+		password, err := network.password()
+		if err != nil {
+			sm.err("Failed to add connection to " + socket + "! Error is: " + err.Error())
+			return nil, false
+		}
+		family, err := dialFamily(network.Family)
+		if err != nil {
+			sm.err("Failed to add connection to " + socket + "! Error is: " + err.Error())
+			return nil, false
+		}
+		ic.Password = password
+		ic.TLS = network.TLS
+		ic.Proxy = network.Proxy
+		ic.Family = family
+		ic.LocalAddr = network.Bind
+		ic.network = network
+	}
+	// dialing can take a while, so it happens off the event loop and the
+	// server is listed in the meantime
+	sm.note("Connecting to " + socket + "...")
+	ic.ConnectAsync(func(err error) {
+		if err != nil {
+			sm.err("Failed to add connection to " + socket + "! Error is: " + err.Error())
+			sm.dropServer(ic)
+		}
+	})
+	sm.servers = append(sm.servers, ic)
+	sm.current = ic
+	return ic, true
+}
+
+// takes server off the server list, switching to another if it was current
+func (sm *ServerManager) dropServer(server *IrcServer) {
+	for idx := range sm.servers {
+		if sm.servers[idx] == server {
+			sm.servers = append(sm.servers[:idx], sm.servers[idx+1:]...)
+			break
+		}
+	}
+	if sm.current == server {
+		sm.current = nil
+		if len(sm.servers) > 0 {
+			sm.current = sm.servers[0]
+		}
+	}
+}
+
+func (sm *ServerManager) handleTermination() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	// close every connection
+	go func() {
+		sig := <-sigs
+		sm.post(func() {
+			sm.info("Received " + sig.String() + ", quitting all active chats...")
+			sm.quitAll("")
+		})
+	}()
+}
+
+// runs a built-in, script or, for cmd "", sends args to the current channel
+func (sm *ServerManager) processCommand(cmd string, args string) {
+	var err error
+	if cmd == "" {
+		err = sm.messageCurrent(args)
+	} else if command := commandIndex[cmd]; command != nil {
+		err = command.checkArgs(args)
+		if err == nil && command.NeedsServer && sm.current == nil {
+			err = errors.New("Not on any server! Enter `/connect <host>` to connect to one.")
+		} else if err == nil {
+			err = command.Run(sm, args)
+		}
+	} else if script, fn := sm.scriptCommand(cmd); script != nil {
+		// scripts can add commands but not replace the built-in ones
+		err = sm.runScriptCommand(script, fn, args)
+	} else {
+		err = errors.New(cmd + " is an unrecognized command! Enter `/help` for a list of commands.")
+	}
+	if err != nil {
+		sm.err(err.Error())
+	}
+}
+
+func (sm *ServerManager) messageCurrent(args string) error {
+	if sm.current == nil {
+		return errors.New("Not on any server!")
+	}
+	if sm.current.currentChannel == nil {
+		return errors.New("No current channel selected!")
+
+	}
+	if strings.TrimSpace(args) == "" {
+		return nil
+	}
+	sm.message(sm.current.currentChannel.Name + " " + args)
+	return nil
+}
+func (sm *ServerManager) message(args string) error {
+	strs := strings.SplitN(args, " ", 2)
+	if len(strs) < 2 {
+		return errors.New("Must specify a channel and message text!")
+	}
+	if !sm.current.Connected {
+		return errors.New("Not connected to " + sm.current.Addr + ", enter `/reconnect` to connect again")
+	}
+	target := strs[0]
+	message := strs[1]
+	sm.echoMessages(target, sm.current.SendText("PRIVMSG", target, message))
+	return nil
+}
+func (sm *ServerManager) quitAll(args string) error {
+	message := strings.TrimSpace(args)
+	if message == "" {
+		message = "Quit command received"
+	}
+	for _, ic := range sm.servers {
+		if ic.Connected {
+			ic.Quit(message)
+		}
+	}
+	sm.Close()
+	os.Exit(0)
+	return errors.New("Failed to exit program")
+}
+func (sm *ServerManager) switchChannel(args string) error {
+	newName := strings.TrimSpace(args)
+	for _, channel := range sm.current.Channels {
+		if channel.Name == newName {
+			sm.current.currentChannel = channel
+			sm.current.debugShown = false
+			channel.UpdateTime = time.Now()
+			sm.redraw()
+			sm.info("Switched to " + newName)
+			return nil
+		}
+	}
+	return errors.New("No such channel " + newName + "!")
+}
+
+// join one or more comma separated channels, with optional comma separated
+// keys in the same order, e.g. `#a,#b keyA,keyB`
+func (sm *ServerManager) joinChannel(args string) error {
+	strs := strings.Fields(args)
+	if len(strs) == 0 || len(strs) > 2 {
+		return errors.New("Usage: /join <channel>[,<channel>...] [<key>[,<key>...]]")
+	}
+	channelNames := strings.Split(strs[0], ",")
+	var keys []string
+	if len(strs) > 1 {
+		keys = strings.Split(strs[1], ",")
+	}
+	sm.note("Joining " + strings.Join(channelNames, ", ") + "...")
+	sm.current.Join(channelNames, keys)
+	// channels are added and set as current when server sends JOIN back
+	return nil
+}
+
+func (sm *ServerManager) newServer(args string) error {
+	strs := strings.Fields(args)
+	// TODO check if server already exists
+	useTLS := false
+	proxy, family, bind := "", "", ""
+	for len(strs) > 0 && strings.HasPrefix(strs[0], "-") {
+		switch {
+		case strs[0] == "-tls":
+			useTLS = true
+			strs = strs[1:]
+		case strs[0] == "-4" || strs[0] == "-6":
+			family = strs[0][1:]
+			strs = strs[1:]
+		case strs[0] == "-proxy" && len(strs) > 1:
+			if _, err := irc.ParseProxy(strs[1]); err != nil {
+				return errors.New("Can't use that proxy! Error is: " + err.Error())
+			}
+			proxy = strs[1]
+			strs = strs[2:]
+		case strs[0] == "-bind" && len(strs) > 1:
+			bind = strs[1]
+			strs = strs[2:]
+		default:
+			return errors.New("Usage: " + commandIndex["connect"].usageLine())
+		}
+	}
+	if len(strs) == 0 || len(strs) > 2 {
+		return errors.New("Usage: " + commandIndex["connect"].usageLine())
+	}
+	port := ""
+	if len(strs) > 1 {
+		port = strs[1]
+	}
+	socket, network, err := sm.findNetwork(strs[0], port, useTLS)
+	if err != nil {
+		return err
+	}
+	if proxy != "" || family != "" || bind != "" {
+		if network == nil {
+			network = &Network{}
+		}
+		if proxy != "" {
+			network.Proxy = proxy
+		}
+		if family != "" {
+			network.Family = family
+		}
+		if bind != "" {
+			network.Bind = bind
+		}
+	}
+	// TODO handle user/real name in a customizable way
+	sm.addConnection(socket, "", "corgi.def", "corgi.def", network)
+	return nil
+}
+func (sm *ServerManager) switchServer(args string) error {
+	strs := strings.Fields(args)
+	if len(strs) != 1 {
+		return errors.New("Must provide a single server name!")
+	}
+	// TODO partial matches
+	for _, server := range sm.servers {
+		if server.Addr == strs[0] {
+			sm.current = server
+			sm.redraw()
+			return nil
+		}
+	}
+	return errors.New("`" + strs[0] + "` not found! Enter `/servers` for available servers.")
+}
+
+// the server with the given socket, or nil
+// TODO partial matches
+func (sm *ServerManager) findServer(socket string) *IrcServer {
+	for _, server := range sm.servers {
+		if server.Addr == socket {
+			return server
+		}
+	}
+	return nil
+}
+
+// `/disconnect [-keep] [<server> [<quit message>]]` quits the server, the
+// current one if none is given. Unless -keep is given the server is taken off
+// the server list, but either way `/reconnect` can bring it back.
+func (sm *ServerManager) disconnectServer(args string) error {
+	strs := strings.Fields(args)
+	keep := len(strs) > 0 && strs[0] == "-keep"
+	if keep {
+		strs = strs[1:]
+	}
+	server := sm.current
+	if len(strs) > 0 {
+		if server = sm.findServer(strs[0]); server == nil {
+			return errors.New("`" + strs[0] + "` not found! Enter `/servers` for available servers.")
+		}
+		strs = strs[1:]
+	} else if server == nil {
+		return errors.New("Must be connected to a server to disconnect!")
+	}
+	message := "Disconnecting"
+	if len(strs) > 0 {
+		message = strings.Join(strs, " ")
+	}
+	server.Disconnect(message)
+	if !keep {
+		sm.dropServer(server)
+		sm.closed[server.Addr] = server
+	}
+	sm.warn("Disconnected from " + server.Addr)
+	return nil
+}
+
+// `/reconnect [<server>]` connects a disconnected server again, the current
+// one if none is given
+func (sm *ServerManager) reconnectServer(args string) error {
+	strs := strings.Fields(args)
+	if len(strs) > 1 {
+		return errors.New("Must provide a single server name!")
+	}
+	server := sm.current
+	if len(strs) == 1 {
+		server = sm.findServer(strs[0])
+		if server == nil {
+			server = sm.closed[strs[0]]
+		}
+		if server == nil {
+			return errors.New("`" + strs[0] + "` not found! Enter `/servers` for available servers.")
+		}
+	} else if server == nil {
+		return errors.New("Must provide a server to reconnect to!")
+	}
+	if server.Connected || server.Connecting() {
+		return errors.New("Already connected to " + server.Addr + "!")
+	}
+	sm.note("Reconnecting to " + server.Addr + "...")
+	server.ConnectAsync(func(err error) {
+		if err != nil {
+			sm.err("Failed to reconnect to " + server.Addr + "! Error is: " + err.Error())
+		}
+	})
+	if sm.closed[server.Addr] == server {
+		delete(sm.closed, server.Addr)
+		sm.servers = append(sm.servers, server)
+	}
+	sm.current = server
+	return nil
+}
+
+func (sm *ServerManager) outputServers(args string) error {
+	if len(sm.servers) > 0 {
+		sm.output(RoleInfo.Text("All connected servers:"))
+		for _, server := range sm.servers {
+			message := []Segment{RoleServer.Text(server.Addr)}
+			if server.Connected && server.Proxy != "" {
+				message = append(message, RoleNote.Text(" (via proxy "+server.RemoteAddr+")"))
+			} else if server.Connected && server.RemoteAddr != "" {
+				message = append(message, RoleNote.Text(" ("+server.RemoteAddr+")"))
+			}
+			if server.TLS {
+				message = append(message, RoleNote.Text(" [tls]"))
+			}
+			if server == sm.current {
+				message = append(message, RoleSuccess.Text(" [active]"))
+			}
+			message = append(message, RoleInfo.Text(" as"))
+			if server.Nick == "" {
+				message = append(message, RoleNick.Text(" [no nick]"))
+			} else {
+				message = append(message, RoleOwnNick.Text(" "+server.Nick))
+			}
+			if server.currentChannel != nil {
+				message = append(
+					message,
+					RoleInfo.Text(" on"),
+					RoleChannel.Text(" "+server.currentChannel.Name))
+			}
+			if server.Connecting() {
+				message = append(message, RoleWarning.Text(" [connecting]"))
+			} else if !server.Connected {
+				message = append(message, RoleError.Text(" [disconnected]"))
+			} else if lag := lagString(server); lag != "" {
+				message = append(message, RoleInfo.Text(" lag"), RoleNote.Text(" "+lag))
+			}
+			sm.output(message...)
+		}
+	} else {
+		sm.info("Not connected to any servers")
+	}
+	return nil
+}
+
+// only works when the first arg is the channel
+// extracts channel from arg list, substituting current channel if none was specified.
+// error condition if no current channel and no channel specified.
+// returns true, "" on error, false, channelName on success
+func (sm *ServerManager) channelFromArgs(args string) (bool, string) {
+	channelName := ""
+	// extract channel name
+	if args == "" {
+		if sm.current.currentChannel == nil {
+			return true, ""
+		}
+		channelName = sm.current.currentChannel.Name
+	} else {
+		channelName = strings.TrimSpace(strings.Fields(args)[0])
+	}
+	return false, channelName
+}
+
+func (sm *ServerManager) partChannel(args string) error {
+	err, channelName := sm.channelFromArgs(args)
+	if err {
+		return errors.New("Cannot part: no active channel and no channel specified")
+	}
+	sm.current.Part(channelName)
+	// channel is added and set as current when server sends JOIN back
+	return nil
+}
+
+func (sm *ServerManager) setNick(args string) error {
+	newNick := strings.TrimSpace(args)
+	if len(newNick) == 0 {
+		return errors.New("Must specify a nick!")
+	} else if strings.Contains(newNick, " ") {
+		return errors.New("Nick cannot contain spaces!")
+	}
+	sm.current.SetNick(newNick)
+	return nil
+}
+func (sm *ServerManager) outputChannels(args string) error {
+	sm.output(RoleInfo.Text("All connected channels on: "), RoleServer.Text(sm.current.Addr))
+	// TODO this output isn't ordered - should we order by something?
+	for _, channel := range sm.current.Channels {
+		if sm.current.currentChannel == channel {
+			sm.output(RoleChannel.Text("  "+channel.Name), RoleSuccess.Text(" [active]"))
+		} else {
+			sm.output(RoleChannel.Text("  " + channel.Name))
+		}
+	}
+	return nil
+}
+func (sm *ServerManager) outputNicks(args string) error {
+	err, channelName := sm.channelFromArgs(args)
+	if err {
+		return errors.New("Can't output nicks: no active channel and no channel specified")
+	}
+	if sm.current.Channels[channelName] == nil {
+		return errors.New("Couldn't look up channel '" + channelName + "'!")
+	}
+	line := []Segment{RoleInfo.Text("All nicks on " + channelName + ":")}
+	for _, nick := range sm.current.Channels[channelName].SortedNicks() {
+		line = append(line, RoleInfo.Text(" "))
+		if _, away := sm.current.AwayNicks[nick]; away {
+			line = append(line, RoleAway.Text(nick))
+		} else {
+			line = append(line, sm.nickText(sm.current, nick, nick))
+		}
+	}
+	sm.output(line...)
+	return nil
+}
+
+func (sm *ServerManager) handleUserInput(input string) {
+	sm.resetIdle()
+	sm.handlePaste(input)
+}
+
+// handles a single line of user input
+func (sm *ServerManager) handleInputLine(input string) {
+	if input, ok := sm.scriptInputHooks(input); ok {
+		sm.runInput(input, nil)
+	}
+}
+
+// aliases are resolved before built-in commands, except for those in seen
+func (sm *ServerManager) runInput(input string, seen map[string]bool) {
+	// split into command + args
+	if strings.HasPrefix(input, "/") && len(strings.Fields(input)) > 0 {
+		cmd := strings.Fields(input)[0]
+		args := strings.TrimSpace(strings.Replace(input, cmd, "", 1))
+		if _, ok := sm.config.Aliases[cmd[1:]]; ok && !seen[cmd[1:]] {
+			sm.runAlias(cmd[1:], args, seen)
+		} else {
+			sm.processCommand(cmd[1:], args)
+		}
+	} else {
+		sm.processCommand("", input)
+	}
+}
+
+func main() {
+	uiName := flag.String("ui", "line", "front-end to use: line, panes or headless. Input history, completion and the formatting keys are only in line.")
+	flag.Parse()
+	var ui Ui
+	switch *uiName {
+	case "panes":
+		// NewPaneUi returns a nil pointer on failure, which isn't a nil Ui
+		if paneUi := NewPaneUi(); paneUi != nil {
+			ui = paneUi
+		}
+	case "line":
+		ui = NewLineUi(os.Stdin, os.Stdout)
+	case "headless":
+		ui = NewHeadlessUi(os.Stdout)
+	default:
+		fmt.Println("Unknown front-end `" + *uiName + "`, must be line, panes or headless")
+	}
+	if ui == nil {
+		os.Exit(1)
+	}
+	sm := NewServerManager(ui)
+	defer sm.Close()
+	sm.success("Initialized Corgi IRC client")
+	// read in args, if any
+	args := flag.Args()
+	if len(args) > 0 {
+		sm.note("Handling commands: `" + strings.Join(args, "`, `") + "`")
+	}
+	for _, arg := range args {
+		sm.handleUserInput(arg)
+	}
+	go sm.readInput()
+	sm.run()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc"
+	"github.com/natemealey/corgi/irc/irctest"
+	"strings"
+	"testing"
+)
+
+func TestJoinAndMessage(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "@alice", "+bob")
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+
+	sm.wait(func() {
+		channel := sm.current.currentChannel
+		if channel == nil || channel.Name != "#go" {
+			t.Fatalf("current channel is %v, want #go", channel)
+		}
+		for _, nick := range []string{"corgi", "alice", "bob"} {
+			if !channel.Nicks[nick] {
+				t.Errorf("%s missing from the nick list", nick)
+			}
+		}
+	})
+
+	c.Send(":alice!alice@localhost PRIVMSG #go :hello corgi")
+	eventually(t, sm, "alice's message", func() bool { return ui.shows("hello corgi") })
+
+	input(sm, "hi alice")
+	c.Expect("PRIVMSG #go :hi alice")
+	sm.wait(func() {
+		if !ui.shows("hi alice") {
+			t.Errorf("our own message wasn't shown")
+		}
+	})
+}
+
+func TestNickChanges(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "alice")
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+
+	c.Send(":alice!alice@localhost NICK :carol")
+	eventually(t, sm, "alice's nick change", func() bool {
+		nicks := sm.current.Channels["#go"].Nicks
+		return nicks["carol"] && !nicks["alice"]
+	})
+	sm.wait(func() {
+		if !ui.shows("alice is now known as carol") {
+			t.Errorf("alice's nick change wasn't shown")
+		}
+	})
+
+	input(sm, "/nick corgi2")
+	c.Expect("NICK corgi2")
+	eventually(t, sm, "our nick change", func() bool {
+		nicks := sm.current.Channels["#go"].Nicks
+		return sm.current.Nick == "corgi2" && nicks["corgi2"] && !nicks["corgi"]
+	})
+}
+
+func TestKick(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "@alice", "bob")
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+
+	c.Send(":alice!alice@localhost KICK #go bob :behave")
+	eventually(t, sm, "bob being kicked", func() bool {
+		return !sm.current.Channels["#go"].Nicks["bob"]
+	})
+	sm.wait(func() {
+		if !ui.shows("bob was kicked from #go by alice") {
+			t.Errorf("bob's kick wasn't shown")
+		}
+	})
+
+	c.Send(":alice!alice@localhost KICK #go corgi :you too")
+	eventually(t, sm, "us being kicked", func() bool {
+		return sm.current.Channels["#go"] == nil && sm.current.currentChannel == nil
+	})
+}
+
+func TestPartSelectsNextChannel(t *testing.T) {
+	sm, _ := newTestManager(t)
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "alice")
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#rust")
+	join(t, sm, c, "#go")
+
+	c.Send(":alice!alice@localhost PART #go")
+	eventually(t, sm, "alice parting", func() bool {
+		return !sm.current.Channels["#go"].Nicks["alice"]
+	})
+
+	input(sm, "/part")
+	c.Expect("PART #go")
+	c.Send(":" + c.Prefix() + " PART #go")
+	eventually(t, sm, "us parting", func() bool {
+		return sm.current.Channels["#go"] == nil &&
+			sm.current.currentChannel != nil && sm.current.currentChannel.Name == "#rust"
+	})
+}
+
+func TestSwitchChannelReplaysLogs(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#rust")
+	c.Send(":alice!alice@localhost PRIVMSG #rust :borrow checker")
+	eventually(t, sm, "the message in #rust", func() bool { return ui.shows("borrow checker") })
+
+	join(t, sm, c, "#go")
+	c.Send(":bob!bob@localhost PRIVMSG #go :goroutines")
+	eventually(t, sm, "the message in #go", func() bool { return ui.shows("goroutines") })
+
+	input(sm, "/channel #rust")
+	sm.wait(func() {
+		if sm.current.currentChannel.Name != "#rust" {
+			t.Fatalf("current channel is %s, want #rust", sm.current.currentChannel.Name)
+		}
+		if !ui.shows("borrow checker") {
+			t.Errorf("#rust's logs weren't replayed")
+		}
+		if ui.shows("goroutines") {
+			t.Errorf("#go's logs were shown in #rust")
+		}
+	})
+}
+
+func TestJoinKeysAndErrors(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+	// everything but #secret lets us in. The error comes last, since joining
+	// clears the screen.
+	fs.On("JOIN", func(c *irctest.Conn, msg irc.Message) {
+		for _, channelName := range strings.Split(msg.Param(0), ",") {
+			if channelName != "#secret" {
+				c.Send(":" + c.Prefix() + " JOIN " + channelName)
+			}
+		}
+		c.Send(":fake.server 475 corgi #secret :Cannot join channel (+k)")
+	})
+
+	input(sm, "/join #open,#secret,#other ,hunter2")
+	c.Expect("JOIN #secret,#open,#other hunter2")
+	eventually(t, sm, "the join error and the other joins", func() bool {
+		return ui.shows("Cannot join #secret: wrong or missing channel key") && sm.current.Channels["#other"] != nil
+	})
+	sm.wait(func() {
+		if sm.current.Channels["#secret"] != nil || sm.current.Channels["#open"] == nil {
+			t.Errorf("joined %v, want #open and #other but not #secret", sm.current.Channels)
+		}
+	})
+
+	// 403 answers other commands too, so it doesn't claim a JOIN failed
+	fs.On("PART", func(c *irctest.Conn, msg irc.Message) {
+		c.Send(":fake.server 403 corgi " + msg.Param(0) + " :No such channel")
+	})
+	input(sm, "/part #nowhere")
+	c.Expect("PART #nowhere")
+	eventually(t, sm, "the part error", func() bool { return ui.shows("No such channel #nowhere") })
+	sm.wait(func() {
+		if ui.shows("Cannot join #nowhere") {
+			t.Errorf("a failed PART was reported as a failed JOIN")
+		}
+	})
+}
+
+func TestDisconnectAndReconnect(t *testing.T) {
+	sm, _ := newTestManager(t)
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+
+	input(sm, "/disconnect -keep")
+	c.Expect("QUIT :Disconnecting")
+	c.ExpectClosed()
+	sm.wait(func() {
+		if len(sm.servers) != 1 || sm.current == nil || sm.current.Connected {
+			t.Fatalf("the server should be kept but disconnected")
+		}
+	})
+
+	input(sm, "/reconnect")
+	c = fs.NextConn()
+	c.Expect("USER")
+	c.Expect("JOIN #go")
+	eventually(t, sm, "rejoining #go", func() bool {
+		return sm.current.Connected && sm.current.Channels["#go"].Nicks["corgi"]
+	})
+
+	socket := ""
+	sm.wait(func() { socket = sm.current.Addr })
+	input(sm, "/disconnect "+socket+" bye now")
+	c.Expect("QUIT :bye now")
+	c.ExpectClosed()
+	sm.wait(func() {
+		if len(sm.servers) != 0 || sm.current != nil {
+			t.Errorf("the server should be off the server list")
+		}
+	})
+}
+
+func TestPasteConfirmation(t *testing.T) {
+	sm, ui := newTestManager(t)
+	sm.wait(func() { sm.config.PasteThreshold = 2 })
+	go sm.readInput()
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+
+	// what the line front-end enters for a paste
+	ui.input <- "one\ntwo"
+	c.Expect("PRIVMSG #go :one")
+	c.Expect("PRIVMSG #go :two")
+	ui.input <- "three\nfour\nfive"
+	eventually(t, sm, "the paste held back", func() bool { return ui.shows("About to send 3 lines") })
+	ui.input <- "/paste"
+	c.Expect("PRIVMSG #go :three")
+	c.Expect("PRIVMSG #go :four")
+	c.Expect("PRIVMSG #go :five")
+
+	ui.input <- "six\nseven\neight"
+	ui.input <- "/paste cancel"
+	eventually(t, sm, "the paste dropped", func() bool { return ui.shows("Dropped 3 pasted lines") })
+	ui.input <- "nine"
+	if line := c.Expect("PRIVMSG #go"); line != "PRIVMSG #go :nine" {
+		t.Errorf("sent %q from a cancelled paste", line)
+	}
+}
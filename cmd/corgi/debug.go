@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"github.com/natemealey/corgi/irc"
+	"strings"
+	"time"
+)
+
+// commands whose parameters are secrets, which the debug buffer and /queue
+// hide
+var redactedCommands = map[string]bool{"PASS": true, "AUTHENTICATE": true, "OPER": true}
+
+// what AUTHENTICATE can carry besides credentials: an empty payload, an
+// abort, or the name of a mechanism
+var saslNotSecret = map[string]bool{
+	"+": true, "*": true, "PLAIN": true, "EXTERNAL": true,
+	"SCRAM-SHA-1": true, "SCRAM-SHA-256": true, "SCRAM-SHA-512": true}
+
+// line with any password or SASL payload in it replaced
+func redact(line string) string {
+	msg := irc.ParseMessage(line)
+	// identifying to services, as a network's perform list might
+	if msg.Command == "PRIVMSG" && strings.EqualFold(msg.Param(0), "NickServ") &&
+		strings.HasPrefix(strings.ToUpper(msg.Text()), "IDENTIFY ") {
+		return "PRIVMSG " + msg.Param(0) + " :IDENTIFY <redacted>"
+	}
+	if !redactedCommands[msg.Command] || len(msg.Params) == 0 {
+		return line
+	}
+	if msg.Command == "AUTHENTICATE" && saslNotSecret[msg.Param(0)] {
+		return line
+	}
+	prefix := ""
+	if msg.Prefix != "" {
+		prefix = ":" + msg.Prefix + " "
+	}
+	return prefix + msg.Command + " <redacted>"
+}
+
+// keeps a line sent to or from ic in its debug buffer, showing it if the
+// buffer's on screen
+func (sm *ServerManager) traceLine(ic *IrcServer, line string, outgoing bool) {
+	if !ic.debug {
+		return
+	}
+	direction := RoleInfo.Text("<< ")
+	if outgoing {
+		direction = RoleSuccess.Text(">> ")
+	}
+	segments := []Segment{
+		RoleTimestamp.Text(time.Now().Format("15:04:05.000") + " "), direction, RoleText.Text(redact(line))}
+	ic.debugLog = append(ic.debugLog, segments)
+	if len(ic.debugLog) > maxLogLines {
+		ic.debugLog = ic.debugLog[len(ic.debugLog)-maxLogLines:]
+	}
+	if sm.current == ic && ic.debugShown {
+		sm.output(segments...)
+	}
+}
+
+// /debug [on|off] starts or stops recording every line sent to and from
+// the current server, and shows the recording in place of the channel
+func (sm *ServerManager) debugCmd(args string) error {
+	ic := sm.current
+	on := !ic.debug
+	switch strings.TrimSpace(args) {
+	case "on":
+		on = true
+	case "off":
+		on = false
+	case "":
+	default:
+		return errors.New("Usage: /debug [on|off]")
+	}
+	if on {
+		ic.debug = true
+		ic.debugShown = true
+		sm.redraw()
+		sm.info("Showing every line to and from " + ic.Addr + ", enter `/debug off` to stop")
+	} else {
+		ic.debug = false
+		ic.debugShown = false
+		ic.debugLog = nil
+		sm.redraw()
+		sm.info("Stopped showing lines to and from " + ic.Addr)
+	}
+	return nil
+}
+
+// /quote <line> sends a raw line to the current server
+func (sm *ServerManager) quote(args string) error {
+	if !sm.current.Connected {
+		return errors.New("Not connected to " + sm.current.Addr + ", enter `/reconnect` to connect again")
+	}
+	sm.current.Send(strings.TrimSpace(args))
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	cases := map[string]string{
+		"PASS hunter2":       "PASS <redacted>",
+		"OPER admin secret":  "OPER <redacted>",
+		"AUTHENTICATE PLAIN": "AUTHENTICATE PLAIN",
+		"AUTHENTICATE +":     "AUTHENTICATE +",
+		"AUTHENTICATE Y29yZ2kAY29yZ2kAaHVudGVyMg==": "AUTHENTICATE <redacted>",
+		"PRIVMSG NickServ :IDENTIFY hunter2":        "PRIVMSG NickServ :IDENTIFY <redacted>",
+		"PRIVMSG #go :my PASS is hunter2":           "PRIVMSG #go :my PASS is hunter2",
+		":fake.server 001 corgi :Welcome":           ":fake.server 001 corgi :Welcome",
+	}
+	for line, want := range cases {
+		if got := redact(line); got != want {
+			t.Errorf("redact(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestQuoteAndDebug(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+
+	input(sm, "/debug")
+	input(sm, "/quote WHOIS alice")
+	c.Expect("WHOIS alice")
+	eventually(t, sm, "the sent line in the debug buffer", func() bool { return ui.shows(">> WHOIS alice") })
+	c.Send(":fake.server 318 corgi alice :End of /WHOIS list")
+	eventually(t, sm, "the received line in the debug buffer", func() bool {
+		return ui.shows("<< :fake.server 318 corgi alice :End of /WHOIS list")
+	})
+	input(sm, "/raw PASS hunter2")
+	c.Expect("PASS hunter2")
+	eventually(t, sm, "the password hidden", func() bool { return ui.shows(">> PASS <redacted>") })
+	sm.wait(func() {
+		if ui.shows("hunter2") {
+			t.Errorf("the debug buffer shows the password")
+		}
+	})
+
+	input(sm, "/debug off")
+	sm.wait(func() {
+		if sm.current.debugShown || sm.current.debugLog != nil {
+			t.Errorf("the debug buffer is still kept after /debug off")
+		}
+	})
+}
+
+func TestQueueHidesPasswords(t *testing.T) {
+	sm, ui := newTestManager(t)
+	// enough to register, then one line every 10 seconds
+	sm.wait(func() {
+		sm.config.FloodBurst = 10
+		sm.config.FloodRate = 0.1
+	})
+	fs := irctest.NewServer(t)
+	connect(t, sm, fs)
+
+	for idx := 0; idx < 12; idx++ {
+		input(sm, "/quote PRIVMSG #go :backlog")
+	}
+	input(sm, "/quote PASS hunter2")
+	input(sm, "/queue")
+	sm.wait(func() {
+		if !ui.shows("PASS <redacted>") || ui.shows("hunter2") {
+			t.Errorf("/queue should list the PASS line without the password, got %q", ui.lines)
+		}
+	})
+}
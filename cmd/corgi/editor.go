@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// the input line for front-ends that read keys themselves, with history and
+// cursor movement. Completion is left to the front-end, since it has to wait
+// on the event loop.
+type lineEditor struct {
+	line    []rune
+	cursor  int
+	history *InputHistory
+}
+
+// the line being edited
+func (e *lineEditor) String() string {
+	return string(e.line)
+}
+
+// the line as it's drawn, with formatting codes shown as reversed letters,
+// e.g. bold's ^B as a reversed B. Each rune still takes one column.
+func (e *lineEditor) display() string {
+	var display strings.Builder
+	for _, r := range e.line {
+		if r < ' ' {
+			display.WriteString("\x1b[7m" + string('A'+r-1) + "\x1b[27m")
+		} else {
+			display.WriteRune(r)
+		}
+	}
+	return display.String()
+}
+
+// replaces the line, leaving the cursor at its end
+func (e *lineEditor) setLine(line string) {
+	e.line = []rune(line)
+	e.cursor = len(e.line)
+}
+
+// applies a key, as readKey names it. On Enter, returns the finished line
+// and true, and starts a new one.
+func (e *lineEditor) handleKey(key string) (string, bool) {
+	switch key {
+	case "Enter":
+		line := e.String()
+		e.history.Add(line)
+		e.setLine("")
+		return line, true
+	case "Backspace":
+		if e.cursor > 0 {
+			e.line = append(e.line[:e.cursor-1], e.line[e.cursor:]...)
+			e.cursor--
+		}
+	case "Delete":
+		if e.cursor < len(e.line) {
+			e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+		}
+	case "Left":
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case "Right":
+		if e.cursor < len(e.line) {
+			e.cursor++
+		}
+	case "Home", "Ctrl+A":
+		e.cursor = 0
+	case "End", "Ctrl+E":
+		e.cursor = len(e.line)
+	case "Up":
+		e.setLine(e.history.Prev(e.String()))
+	case "Down":
+		e.setLine(e.history.Next())
+	default:
+		if code, ok := formatKeys[key]; ok {
+			e.insert(code)
+		} else if r := []rune(key); len(r) == 1 && unicode.IsPrint(r[0]) {
+			e.insert(r[0])
+		}
+	}
+	return "", false
+}
+
+// inserts a bracketed paste at the cursor. If it has line breaks in it, the
+// line up to the last of them is finished, as if each had been Enter, and
+// returned with its lines joined by "\n" so they're entered together. Multi-
+// line pastes are left out of the history.
+func (e *lineEditor) paste(text string) (string, bool) {
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\t", " ").Replace(text)
+	for _, r := range text {
+		if r == '\n' || typeable(r) {
+			e.insert(r)
+		}
+	}
+	line := e.String()
+	end := strings.LastIndex(line, "\n")
+	if end < 0 {
+		return "", false
+	}
+	e.setLine(line[end+1:])
+	line = line[:end]
+	if !strings.Contains(line, "\n") {
+		e.history.Add(line)
+	}
+	return line, true
+}
+
+// whether r can go in the input line: anything printable, or a formatting
+// code, which text pasted from another client may have in it
+func typeable(r rune) bool {
+	if unicode.IsPrint(r) {
+		return true
+	}
+	for _, code := range formatKeys {
+		if r == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.line = append(e.line, 0)
+	copy(e.line[e.cursor+1:], e.line[e.cursor:])
+	e.line[e.cursor] = r
+	e.cursor++
+}
+
+// the final bytes of the escape sequences for keys we use, after ESC [ and
+// any parameters. With bracketed paste turned on, a paste starts with
+// ESC [ 200 ~ and ends with pasteEnd.
+var escapeKeys = map[string]string{
+	"A": "Up", "B": "Down", "C": "Right", "D": "Left", "H": "Home", "F": "End",
+	"1~": "Home", "7~": "Home", "4~": "End", "8~": "End", "3~": "Delete",
+	"200~": "Paste"}
+
+const pasteEnd = "\x1b[201~"
+
+// reads the text of a bracketed paste, after readKey has returned "Paste"
+func readPaste(r *bufio.Reader) (string, error) {
+	var text strings.Builder
+	for !strings.HasSuffix(text.String(), pasteEnd) {
+		ch, _, err := r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		text.WriteRune(ch)
+	}
+	return strings.TrimSuffix(text.String(), pasteEnd), nil
+}
+
+// reads the next key from a terminal: a printable character as itself, or a
+// name like "Enter", "Up", "Ctrl+B" or "Paste". Keys we don't know come back
+// as "".
+func readKey(r *bufio.Reader) (string, error) {
+	ch, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case ch == '\r' || ch == '\n':
+		return "Enter", nil
+	case ch == 0x7f || ch == '\b':
+		return "Backspace", nil
+	case ch == '\t':
+		return "Tab", nil
+	case ch == 0x1b:
+		// a lone ESC, rather than the start of a sequence
+		if r.Buffered() == 0 {
+			return "", nil
+		}
+		if next, _ := r.ReadByte(); next != '[' && next != 'O' {
+			return "", nil
+		}
+		// parameters, then a final byte from @ to ~
+		var seq strings.Builder
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			seq.WriteByte(b)
+			if b >= 0x40 && b <= 0x7e {
+				if key, ok := escapeKeys[seq.String()]; ok {
+					return key, nil
+				}
+				// e.g. Ctrl+Left as ESC [ 1 ; 5 D, treated as Left
+				if b != '~' {
+					return escapeKeys[string(b)], nil
+				}
+				return "", nil
+			}
+		}
+	case ch < ' ':
+		return "Ctrl+" + string('A'+ch-1), nil
+	}
+	return string(ch), nil
+}
+
+// puts the terminal f is on into a mode where keys arrive as they're typed,
+// without being echoed, and returns how to put it back. Fails if f isn't a
+// terminal, or there's no stty to do it with.
+func rawTerminal(f *os.File) (func(), error) {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = f
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	// Ctrl+C still interrupts, but Ctrl+U, Ctrl+O and the like are ours, for
+	// formatting
+	if _, err := stty("-icanon", "-echo", "-iexten", "min", "1"); err != nil {
+		return nil, err
+	}
+	return func() { stty(state) }, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadKey(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("aé\r\x7f\t\x1b[A\x1b[B\x1bOC\x1b[3~\x1b[1;5D\x02\x1b[200~"))
+	want := []string{"a", "é", "Enter", "Backspace", "Tab", "Up", "Down", "Right", "Delete", "Left", "Ctrl+B", "Paste"}
+	for _, w := range want {
+		if key, err := readKey(reader); err != nil || key != w {
+			t.Errorf("readKey() = %q, %v, want %q", key, err, w)
+		}
+	}
+	if _, err := readKey(reader); err == nil {
+		t.Errorf("readKey() at the end of input should fail")
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	e := &lineEditor{history: NewInputHistory(filepath.Join(t.TempDir(), "history.json"))}
+	typeKeys := func(keys ...string) (string, bool) {
+		var line string
+		var done bool
+		for _, key := range keys {
+			line, done = e.handleKey(key)
+		}
+		return line, done
+	}
+	if line, done := typeKeys("h", "é", "l", "o", "Left", "Left", "Backspace", "e", "l", "End", "!", "Enter"); !done || line != "hello!" {
+		t.Errorf("typed %q, %v, want hello!", line, done)
+	}
+	if line, done := typeKeys("w", "o", "r", "l", "d", "Home", "Delete", "W", "Enter"); !done || line != "World" {
+		t.Errorf("typed %q, %v, want World", line, done)
+	}
+	typeKeys("d", "r", "a", "f", "t", "Up", "Up")
+	if e.String() != "hello!" || e.cursor != len("hello!") {
+		t.Errorf("after going up twice the line is %q with the cursor at %d", e.String(), e.cursor)
+	}
+	typeKeys("Down", "Down")
+	if e.String() != "draft" {
+		t.Errorf("going back down gave %q, want the draft", e.String())
+	}
+}
+
+func TestLineUiEditing(t *testing.T) {
+	var out bytes.Buffer
+	ui := &LineUi{
+		out:    &out,
+		input:  make(chan string),
+		editor: &lineEditor{history: NewInputHistory(filepath.Join(t.TempDir(), "history.json"))}}
+	ui.SetCompleter(NewCompleter(func(word string, lineStart bool) []string { return []string{"alice"} }))
+	// a paste of several lines is entered as one, up to its last line break
+	go ui.editInput(strings.NewReader("hi al\t\r\x1b[A\x1b[D\x1b[D\x7f\r" +
+		"so\x1b[200~me\r\nlines\tpasted\x07\nand \x02mo\x1b[201~re\r\x1b[200~one line\x1b[201~\r"))
+	for _, want := range []string{"hi alice", "hi alce", "some\nlines pasted", "and \x02more", "one line"} {
+		if line := <-ui.input; line != want {
+			t.Errorf("entered %q, want %q", line, want)
+		}
+	}
+	if _, ok := <-ui.input; ok {
+		t.Errorf("input wasn't closed at the end")
+	}
+}
+
+func TestFormatKeys(t *testing.T) {
+	e := &lineEditor{history: NewInputHistory(filepath.Join(t.TempDir(), "history.json"))}
+	reader := bufio.NewReader(strings.NewReader("\x02hi\x0f \x0b12red\x15!\r"))
+	var line string
+	for done := false; !done; {
+		key, err := readKey(reader)
+		if err != nil {
+			t.Fatalf("ran out of keys")
+		}
+		line, done = e.handleKey(key)
+	}
+	if want := "\x02hi\x0f \x0312red\x1f!"; line != want {
+		t.Errorf("typed %q, want %q", line, want)
+	}
+	e.setLine("\x02hi")
+	if got := e.display(); got != "\x1b[7mB\x1b[27mhi" {
+		t.Errorf("display() = %q, want the code as a reversed B", got)
+	}
+}
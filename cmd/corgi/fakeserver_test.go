@@ -0,0 +1,111 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a front-end that only remembers what it was asked to show. Like any other
+// Ui it's only used from the event loop, so tests read it with sm.wait.
+type testUi struct {
+	input  chan string
+	lines  []string
+	last   []Segment // the last line, styled
+	prompt string
+	status string
+	alerts string // every sequence sent with Alert
+}
+
+func (ui *testUi) Input() <-chan string { return ui.input }
+func (ui *testUi) Print(segments ...Segment) {
+	ui.lines = append(ui.lines, plainText(segments))
+	ui.last = segments
+}
+func (ui *testUi) Clear()                        { ui.lines = nil }
+func (ui *testUi) SetPrompt(segments ...Segment) { ui.prompt = plainText(segments) }
+func (ui *testUi) SetStatus(segments ...Segment) { ui.status = plainText(segments) }
+func (ui *testUi) SetBuffer(name string)         {}
+func (ui *testUi) Alert(sequence string)         { ui.alerts += sequence }
+func (ui *testUi) Close()                        {}
+
+// whether any line of output contains text
+func (ui *testUi) shows(text string) bool {
+	for _, line := range ui.lines {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// a ServerManager with a testUi and its event loop running, using a
+// throwaway config directory
+func newTestManager(t *testing.T) (*ServerManager, *testUi) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	ui := &testUi{input: make(chan string)}
+	sm := NewServerManager(ui)
+	// no flood protection, pinging or reconnecting to slow tests down
+	sm.config.FloodRate = 0
+	sm.config.PingInterval = 0
+	sm.config.ReconnectDelay = 0
+	go sm.run()
+	t.Cleanup(func() {
+		sm.wait(func() {
+			for _, ic := range sm.servers {
+				ic.Disconnect("")
+			}
+			sm.loop.Stop()
+		})
+	})
+	return sm, ui
+}
+
+// handles input as if the user typed it
+func input(sm *ServerManager, line string) {
+	sm.wait(func() { sm.handleUserInput(line) })
+}
+
+// waits for cond, which is checked on the event loop, to become true
+func eventually(t *testing.T, sm *ServerManager, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(irctest.Timeout)
+	for {
+		ok := false
+		sm.wait(func() { ok = cond() })
+		if ok {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// connects sm to fs as corgi and waits until the server has welcomed it
+func connect(t *testing.T, sm *ServerManager, fs *irctest.Server) *irctest.Conn {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(fs.Addr())
+	input(sm, "/connect "+host+" "+port)
+	c := fs.NextConn()
+	c.Expect("USER")
+	input(sm, "/nick corgi")
+	c.Expect("NICK corgi")
+	eventually(t, sm, "the welcome", func() bool { return sm.current.Hostmask != "" })
+	return c
+}
+
+// joins channelName and waits for its nick list to arrive
+func join(t *testing.T, sm *ServerManager, c *irctest.Conn, channelName string) {
+	t.Helper()
+	input(sm, "/join "+channelName)
+	c.Expect("JOIN " + channelName)
+	eventually(t, sm, "joining "+channelName, func() bool {
+		channel := sm.current.Channels[channelName]
+		return channel != nil && channel.Nicks["corgi"]
+	})
+}
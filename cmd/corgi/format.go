@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mIRC formatting codes, which toggle a style for the rest of the message
+const (
+	fmtBold      = '\x02'
+	fmtColor     = '\x03' // followed by [fg[,bg]], each 1 or 2 digits
+	fmtHexColor  = '\x04' // followed by [RRGGBB[,RRGGBB]]
+	fmtReset     = '\x0f'
+	fmtMonospace = '\x11'
+	fmtReverse   = '\x16'
+	fmtItalic    = '\x1d'
+	fmtStrike    = '\x1e'
+	fmtUnderline = '\x1f'
+)
+
+// keys that insert a formatting code into the input line, as in mIRC.
+// Ctrl+I is Tab in a terminal, so italics get Ctrl+T.
+var formatKeys = map[string]rune{
+	"Ctrl+B": fmtBold,
+	"Ctrl+K": fmtColor,
+	"Ctrl+O": fmtReset,
+	"Ctrl+R": fmtReverse,
+	"Ctrl+T": fmtItalic,
+	"Ctrl+U": fmtUnderline,
+}
+
+// the first 16 mIRC colors, as the nearest in our palette
+var mircHues = [16]Hue{
+	HueWhite, HueBlack, HueBlue, HueGreen, HueLightRed, HueRed, HueMagenta, HueYellow,
+	HueLightYellow, HueLightGreen, HueCyan, HueLightCyan, HueLightBlue, HueLightMagenta,
+	HueDarkGray, HueLightGray}
+
+// mIRC's extended colors 16 to 98 as RGB, matched to our palette by nearestHue
+var mircExtendedRGB = [83]int{
+	0x470000, 0x472100, 0x474700, 0x324700, 0x004700, 0x00472c, 0x004747, 0x002747, 0x000047, 0x2e0047, 0x470047, 0x47002a,
+	0x740000, 0x743a00, 0x747400, 0x517400, 0x007400, 0x007449, 0x007474, 0x004074, 0x000074, 0x4b0074, 0x740074, 0x740045,
+	0xb50000, 0xb56300, 0xb5b500, 0x7db500, 0x00b500, 0x00b571, 0x00b5b5, 0x0063b5, 0x0000b5, 0x7500b5, 0xb500b5, 0xb5006b,
+	0xff0000, 0xff8c00, 0xffff00, 0xb2ff00, 0x00ff00, 0x00ffa0, 0x00ffff, 0x008cff, 0x0000ff, 0xa500ff, 0xff00ff, 0xff0098,
+	0xff5959, 0xffb459, 0xffff71, 0xcfff60, 0x6fff6f, 0x65ffc9, 0x6dffff, 0x59b4ff, 0x5959ff, 0xc459ff, 0xff66ff, 0xff59bc,
+	0xff9c9c, 0xffd39c, 0xffff9c, 0xe2ff9c, 0x9cff9c, 0x9cffdb, 0x9cffff, 0x9cd3ff, 0x9c9cff, 0xdc9cff, 0xff9cff, 0xff94d3,
+	0x000000, 0x131313, 0x282828, 0x363636, 0x4d4d4d, 0x656565, 0x818181, 0x9f9f9f, 0xbcbcbc, 0xe2e2e2, 0xffffff}
+
+// what each hue typically looks like, for finding the nearest to an RGB color
+var hueRGB = map[Hue]int{
+	HueBlack: 0x000000, HueRed: 0x800000, HueGreen: 0x008000, HueYellow: 0x808000,
+	HueBlue: 0x000080, HueMagenta: 0x800080, HueCyan: 0x008080, HueLightGray: 0xc0c0c0,
+	HueDarkGray: 0x808080, HueLightRed: 0xff0000, HueLightGreen: 0x00ff00, HueLightYellow: 0xffff00,
+	HueLightBlue: 0x0000ff, HueLightMagenta: 0xff00ff, HueLightCyan: 0x00ffff, HueWhite: 0xffffff}
+
+// the hue closest to rgb, by squared distance
+func nearestHue(rgb int) Hue {
+	best, bestDist := HueDefault, -1
+	for hue := HueBlack; hue <= HueWhite; hue++ {
+		dist := 0
+		for shift := 0; shift <= 16; shift += 8 {
+			d := (rgb>>shift)&0xff - (hueRGB[hue]>>shift)&0xff
+			dist += d * d
+		}
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = hue, dist
+		}
+	}
+	return best
+}
+
+// the hue for mIRC color number n, with 99 meaning the default
+func mircHue(n int, def Hue) Hue {
+	switch {
+	case n < 16:
+		return mircHues[n]
+	case n < 99:
+		return nearestHue(mircExtendedRGB[n-16])
+	}
+	return def
+}
+
+// reads up to two digits from the start of text, returning the number and
+// how many bytes it took
+func readColorNumber(text string) (int, int) {
+	n := 0
+	for n < 2 && n < len(text) && text[n] >= '0' && text[n] <= '9' {
+		n++
+	}
+	if n == 0 {
+		return -1, 0
+	}
+	num, _ := strconv.Atoi(text[:n])
+	return num, n
+}
+
+// reads an RRGGBB from the start of text, returning -1 if there isn't one
+func readHexColor(text string) int {
+	if len(text) < 6 {
+		return -1
+	}
+	rgb, err := strconv.ParseUint(text[:6], 16, 32)
+	if err != nil {
+		return -1
+	}
+	return int(rgb)
+}
+
+// splits text with mIRC formatting codes into segments, starting from and
+// resetting to base
+func parseFormatting(text string, base Segment) []Segment {
+	var segments []Segment
+	style := base
+	var run strings.Builder
+	flush := func() {
+		if run.Len() > 0 {
+			style.Text = run.String()
+			segments = append(segments, style)
+			run.Reset()
+		}
+	}
+	for idx := 0; idx < len(text); idx++ {
+		switch text[idx] {
+		case fmtBold:
+			flush()
+			style.Attrs ^= AttrBold
+		case fmtItalic:
+			flush()
+			style.Attrs ^= AttrItalic
+		case fmtUnderline:
+			flush()
+			style.Attrs ^= AttrUnderline
+		case fmtReverse:
+			flush()
+			style.Attrs ^= AttrReverse
+		case fmtStrike:
+			flush()
+			style.Attrs ^= AttrStrike
+		case fmtMonospace:
+			// everything's monospace in a terminal
+		case fmtReset:
+			flush()
+			style = base
+		case fmtColor:
+			flush()
+			fg, n := readColorNumber(text[idx+1:])
+			if n == 0 {
+				// a bare color code resets the colors
+				style.Hue, style.Background = base.Hue, base.Background
+				break
+			}
+			idx += n
+			style.Hue = mircHue(fg, base.Hue)
+			if idx+1 < len(text) && text[idx+1] == ',' {
+				if bg, n := readColorNumber(text[idx+2:]); n > 0 {
+					idx += n + 1
+					style.Background = mircHue(bg, base.Background)
+				}
+			}
+		case fmtHexColor:
+			flush()
+			fg := readHexColor(text[idx+1:])
+			if fg < 0 {
+				style.Hue, style.Background = base.Hue, base.Background
+				break
+			}
+			idx += 6
+			style.Hue = nearestHue(fg)
+			if idx+1 < len(text) && text[idx+1] == ',' {
+				if bg := readHexColor(text[idx+2:]); bg >= 0 {
+					idx += 7
+					style.Background = nearestHue(bg)
+				}
+			}
+		default:
+			run.WriteByte(text[idx])
+		}
+	}
+	flush()
+	return segments
+}
+
+// text without any formatting codes
+func stripFormatting(text string) string {
+	return plainText(parseFormatting(text, Segment{}))
+}
+
+// how text from a server is shown: styled, or stripped if the config says so
+func (sm *ServerManager) formatText(text string, base Segment) []Segment {
+	if sm.config.StripFormatting {
+		base.Text = stripFormatting(text)
+		return []Segment{base}
+	}
+	return parseFormatting(text, base)
+}
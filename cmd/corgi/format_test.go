@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFormatting(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Segment
+	}{
+		{"plain", []Segment{{Text: "plain"}}},
+		{"\x02bold\x02 not", []Segment{{Text: "bold", Attrs: AttrBold}, {Text: " not"}}},
+		{"\x034,2red on blue\x03 plain", []Segment{
+			{Text: "red on blue", Hue: HueLightRed, Background: HueBlue}, {Text: " plain"}}},
+		{"\x0399,99default", []Segment{{Text: "default"}}},
+		{"\x031,text", []Segment{{Text: ",text", Hue: HueBlack}}},
+		{"\x1d\x1fboth\x0f reset", []Segment{
+			{Text: "both", Attrs: AttrItalic | AttrUnderline}, {Text: " reset"}}},
+		{"\x04ff0000red", []Segment{{Text: "red", Hue: HueLightRed}}},
+	}
+	for _, test := range tests {
+		if got := parseFormatting(test.text, Segment{}); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseFormatting(%q) = %+v, want %+v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestStripFormatting(t *testing.T) {
+	if got := stripFormatting("\x02hi\x02 \x0312,01there\x03\x16!"); got != "hi there!" {
+		t.Errorf("stripFormatting = %q", got)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"github.com/natemealey/corgi/irc"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// what makes a message a highlight, as set in the config
+type HighlightRules struct {
+	// turns off highlighting on our own nick
+	IgnoreNick bool `json:"ignore_nick"`
+	// words that highlight, matched whole and in any case
+	Words []string `json:"words"`
+	// regular expressions that highlight, e.g. "(?i)\\bdeploy(ed|ing)?\\b"
+	Patterns []string `json:"patterns"`
+	// hostmasks whose messages never highlight, e.g. bots
+	ExcludeMasks []string `json:"exclude_masks"`
+	// channels where nothing highlights
+	ExcludeChannels []string `json:"exclude_channels"`
+}
+
+// HighlightRules ready to match against
+type highlighter struct {
+	rules    HighlightRules
+	patterns []*regexp.Regexp
+}
+
+// the highlighters for the config's rules: the global ones, and the ones for
+// particular channels that replace them there
+type highlighters struct {
+	global   highlighter
+	channels map[string]highlighter // by lowercased channel name
+}
+
+// how many highlights /mentions remembers
+const maxMentions = 1000
+
+// a highlight, kept for /mentions
+type mention struct {
+	ic     *IrcServer
+	target string // the channel, or the nick for private messages
+	time   time.Time
+	line   []Segment
+}
+
+func (sm *ServerManager) newHighlighter(rules HighlightRules) highlighter {
+	h := highlighter{rules: rules}
+	for _, expr := range rules.Patterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			sm.err("Ignoring highlight pattern `" + expr + "`! Error is: " + err.Error())
+			continue
+		}
+		h.patterns = append(h.patterns, re)
+	}
+	return h
+}
+
+// compiles the config's highlight rules, reporting the ones that don't
+func (sm *ServerManager) loadHighlights() {
+	sm.highlights = highlighters{
+		global:   sm.newHighlighter(sm.config.Highlights),
+		channels: make(map[string]highlighter)}
+	for channelName, rules := range sm.config.ChannelHighlights {
+		sm.highlights.channels[strings.ToLower(channelName)] = sm.newHighlighter(rules)
+	}
+}
+
+// whether text, sent by prefix to target on ic, highlights us
+func (sm *ServerManager) isHighlight(ic *IrcServer, prefix, target, text string) bool {
+	h, ok := sm.highlights.channels[strings.ToLower(target)]
+	if !ok {
+		h = sm.highlights.global
+	}
+	for _, channelName := range h.rules.ExcludeChannels {
+		if strings.EqualFold(channelName, target) {
+			return false
+		}
+	}
+	for _, mask := range h.rules.ExcludeMasks {
+		if irc.MatchMask(irc.NormalizeMask(mask), prefix) {
+			return false
+		}
+	}
+	text = stripFormatting(text)
+	if !h.rules.IgnoreNick && mentions(text, ic.Nick) {
+		return true
+	}
+	for _, word := range h.rules.Words {
+		if mentions(text, word) {
+			return true
+		}
+	}
+	for _, re := range h.patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// keeps a highlighted line for /mentions
+func (sm *ServerManager) addMention(ic *IrcServer, target string, segments []Segment) {
+	sm.mentions = append(sm.mentions, mention{ic, target, time.Now(), segments})
+	if len(sm.mentions) > maxMentions {
+		sm.mentions = sm.mentions[len(sm.mentions)-maxMentions:]
+	}
+}
+
+// counts a message to channelName on ic that isn't on screen
+func (ic *IrcServer) countUnread(channelName string, highlight bool) {
+	ic.unread[channelName]++
+	if highlight {
+		ic.highlighted[channelName]++
+	}
+}
+
+// the channels on ic with messages that haven't been seen, for the status
+// line, e.g. "#go:3 #rust:1" with highlighted channels in the highlight style
+func (ic *IrcServer) activity() []Segment {
+	var channelNames []string
+	for channelName := range ic.unread {
+		channelNames = append(channelNames, channelName)
+	}
+	sort.Strings(channelNames)
+	var segments []Segment
+	for _, channelName := range channelNames {
+		role := RoleStatus
+		if ic.highlighted[channelName] > 0 {
+			role = RoleHighlight
+		}
+		segments = append(segments, RoleStatus.Text(" "), role.Text(channelName+":"+strconv.Itoa(ic.unread[channelName])))
+	}
+	return segments
+}
+
+// /mentions lists the highlights on every server, /mentions <n> goes to the
+// channel the nth one was in, /mentions clear forgets them
+func (sm *ServerManager) outputMentions(args string) error {
+	args = strings.TrimSpace(args)
+	switch {
+	case args == "":
+		if len(sm.mentions) == 0 {
+			sm.info("No mentions")
+			return nil
+		}
+		sm.info("All mentions:")
+		for idx, mention := range sm.mentions {
+			line := []Segment{
+				RoleItem.Text("  " + strconv.Itoa(idx+1) + " "),
+				RoleTimestamp.Text(mention.time.Format("2006-01-02 15:04") + " "),
+				RoleServer.Text(mention.ic.Addr + " ")}
+			sm.output(append(line, mention.line...)...)
+		}
+		return nil
+	case args == "clear":
+		sm.mentions = nil
+		sm.info("Cleared all mentions")
+		return nil
+	}
+	num, err := strconv.Atoi(args)
+	if err != nil || num < 1 || num > len(sm.mentions) {
+		return errors.New("Usage: /mentions [<number>|clear], where the number is from the list")
+	}
+	mention := sm.mentions[num-1]
+	if !sm.hasServer(mention.ic) {
+		return errors.New("Disconnected from " + mention.ic.Addr + ", enter `/reconnect " + mention.ic.Addr + "` first")
+	}
+	sm.current = mention.ic
+	mention.ic.debugShown = false
+	if channel := mention.ic.Channels[mention.target]; channel != nil {
+		mention.ic.currentChannel = channel
+		channel.UpdateTime = time.Now()
+	}
+	sm.redraw()
+	if !irc.IsChannel(mention.target) {
+		sm.info("Mention " + args + " was a private message from " + mention.target)
+	} else if mention.ic.Channels[mention.target] == nil {
+		sm.info("No longer on " + mention.target)
+	}
+	return nil
+}
+
+// whether ic is one of our servers, rather than one we've closed
+func (sm *ServerManager) hasServer(ic *IrcServer) bool {
+	for _, server := range sm.servers {
+		if server == ic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"strings"
+	"testing"
+)
+
+func TestHighlights(t *testing.T) {
+	sm, ui := newTestManager(t)
+	sm.wait(func() {
+		sm.config.Highlights = HighlightRules{
+			Words:        []string{"gopher"},
+			ExcludeMasks: []string{"bot!*@*"}}
+		// only deploys are worth a highlight on #noisy
+		sm.config.ChannelHighlights = map[string]HighlightRules{
+			"#noisy": {IgnoreNick: true, Patterns: []string{`(?i)\bdeploy(ed)?\b`}}}
+		sm.loadHighlights()
+	})
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "alice", "bot")
+	fs.SetMembers("#noisy", "alice")
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#noisy")
+	join(t, sm, c, "#go")
+
+	c.Send(":alice!alice@localhost PRIVMSG #go :corgi: ping")
+	c.Send(":alice!alice@localhost PRIVMSG #go :any Gophers here?")
+	c.Send(":alice!alice@localhost PRIVMSG #go :a gopher, then")
+	c.Send(":bot!bot@localhost PRIVMSG #go :corgi: beep")
+	c.Send(":alice!alice@localhost PRIVMSG #noisy :corgi in here")
+	c.Send(":alice!alice@localhost PRIVMSG #noisy :Deployed it")
+	c.Send(":alice!alice@localhost PRIVMSG #noisy :last")
+	eventually(t, sm, "the messages", func() bool { return sm.current.unread["#noisy"] == 3 })
+
+	var got []string
+	sm.wait(func() {
+		for _, mention := range sm.mentions {
+			got = append(got, plainText(mention.line))
+		}
+		if sm.current.highlighted["#noisy"] != 1 {
+			t.Errorf("%d highlights counted on #noisy, want 1", sm.current.highlighted["#noisy"])
+		}
+		if !strings.HasSuffix(ui.status, " #noisy:3") {
+			t.Errorf("status is %q, want the unread count", ui.status)
+		}
+	})
+	want := []string{"#go <alice> corgi: ping", "#go <alice> a gopher, then", "#noisy <alice> Deployed it"}
+	if len(got) != len(want) {
+		t.Fatalf("mentions are %q, want %q", got, want)
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Errorf("mention %d is %q, want %q", idx+1, got[idx], want[idx])
+		}
+	}
+
+	input(sm, "/mentions 3")
+	sm.wait(func() {
+		if sm.current.currentChannel.Name != "#noisy" || !ui.shows("Deployed it") {
+			t.Errorf("/mentions 3 went to %s showing %q", sm.current.currentChannel.Name, ui.lines)
+		}
+		if sm.current.unread["#noisy"] != 0 || sm.current.highlighted["#noisy"] != 0 {
+			t.Errorf("#noisy is still unread after being shown")
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"github.com/natemealey/corgi/irc"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// message types an ignore can be scoped to
+var ignoreTypes = []string{"PRIVMSG", "NOTICE", "CTCP", "JOIN", "PART", "QUIT", "INVITE"}
+
+// silences everyone whose nick!user@host matches Mask
+type Ignore struct {
+	Mask    string    `json:"mask"`
+	Types   []string  `json:"types,omitempty"`   // empty means every type
+	Channel string    `json:"channel,omitempty"` // empty means everywhere
+	Expires time.Time `json:"expires"`           // zero means never
+}
+
+func (ignore Ignore) expired() bool {
+	return !ignore.Expires.IsZero() && time.Now().After(ignore.Expires)
+}
+
+func (ignore Ignore) matches(prefix, msgType, channelName string) bool {
+	if ignore.expired() || !irc.MatchMask(ignore.Mask, prefix) {
+		return false
+	}
+	if ignore.Channel != "" && !strings.EqualFold(ignore.Channel, channelName) {
+		return false
+	}
+	if len(ignore.Types) == 0 {
+		return true
+	}
+	for _, ignoredType := range ignore.Types {
+		if ignoredType == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+func (ignore Ignore) String() string {
+	str := ignore.Mask
+	if len(ignore.Types) > 0 {
+		str += " " + strings.Join(ignore.Types, ",")
+	}
+	if ignore.Channel != "" {
+		str += " on " + ignore.Channel
+	}
+	if !ignore.Expires.IsZero() {
+		str += " until " + ignore.Expires.Format("2006-01-02 15:04")
+	}
+	return str
+}
+
+// CTCP requests and replies travel inside PRIVMSG and NOTICE. /me actions
+// do too, but they're messages like any other.
+func messageType(command, message string) string {
+	if strings.HasPrefix(message, "\x01ACTION ") {
+		return command
+	}
+	if (command == "PRIVMSG" || command == "NOTICE") && strings.HasPrefix(message, "\x01") {
+		return "CTCP"
+	}
+	return command
+}
+
+func (sm *ServerManager) isIgnored(prefix, msgType, channelName string) bool {
+	// only messages from other users have a full prefix
+	if !strings.Contains(prefix, "!") {
+		return false
+	}
+	for _, ignore := range sm.config.Ignores {
+		if ignore.matches(prefix, msgType, channelName) {
+			return true
+		}
+	}
+	return false
+}
+
+// drops expired ignores, returning whether there were any
+func (sm *ServerManager) pruneIgnores() bool {
+	var ignores []Ignore
+	for _, ignore := range sm.config.Ignores {
+		if !ignore.expired() {
+			ignores = append(ignores, ignore)
+		}
+	}
+	pruned := len(ignores) != len(sm.config.Ignores)
+	sm.config.Ignores = ignores
+	return pruned
+}
+
+// /ignore <mask> [types] [-channel <channel>] [-for <duration>], where types
+// are comma or space separated. With no arguments, lists the ignores.
+func (sm *ServerManager) addIgnore(args string) error {
+	strs := strings.Fields(args)
+	if len(strs) == 0 {
+		return sm.outputIgnores()
+	}
+	ignore := Ignore{Mask: irc.NormalizeMask(strs[0])}
+	for idx := 1; idx < len(strs); idx++ {
+		switch strs[idx] {
+		case "-channel":
+			if idx+1 >= len(strs) {
+				return errors.New("-channel needs a channel name!")
+			}
+			idx++
+			ignore.Channel = strs[idx]
+		case "-for":
+			if idx+1 >= len(strs) {
+				return errors.New("-for needs a duration, like 30m or 2h!")
+			}
+			idx++
+			duration, err := time.ParseDuration(strs[idx])
+			if err != nil {
+				return errors.New("Invalid duration " + strs[idx] + ", try something like 30m or 2h!")
+			}
+			ignore.Expires = time.Now().Add(duration)
+		default:
+			for _, ignoreType := range strings.Split(strs[idx], ",") {
+				ignoreType = strings.ToUpper(ignoreType)
+				valid := false
+				for _, knownType := range ignoreTypes {
+					valid = valid || knownType == ignoreType
+				}
+				if !valid {
+					return errors.New("Unknown message type " + ignoreType + ", must be one of " + strings.Join(ignoreTypes, ", "))
+				}
+				ignore.Types = append(ignore.Types, ignoreType)
+			}
+		}
+	}
+	sm.pruneIgnores()
+	sm.config.Ignores = append(sm.config.Ignores, ignore)
+	sm.info("Ignoring " + ignore.String())
+	return sm.config.Save()
+}
+
+// /unignore <mask or number from /ignore>
+func (sm *ServerManager) removeIgnore(args string) error {
+	target := strings.TrimSpace(args)
+	if target == "" {
+		return errors.New("Usage: /unignore <mask or number>")
+	}
+	sm.pruneIgnores()
+	for idx, ignore := range sm.config.Ignores {
+		if strconv.Itoa(idx+1) == target || strings.EqualFold(ignore.Mask, irc.NormalizeMask(target)) {
+			sm.config.Ignores = append(sm.config.Ignores[:idx], sm.config.Ignores[idx+1:]...)
+			sm.info("No longer ignoring " + ignore.String())
+			return sm.config.Save()
+		}
+	}
+	return errors.New("Not ignoring " + target + "!")
+}
+
+func (sm *ServerManager) outputIgnores() error {
+	if sm.pruneIgnores() {
+		sm.config.Save()
+	}
+	if len(sm.config.Ignores) == 0 {
+		sm.info("Not ignoring anyone")
+		return nil
+	}
+	sm.info("All ignores:")
+	for idx, ignore := range sm.config.Ignores {
+		sm.output(RoleItem.Text("  "+strconv.Itoa(idx+1)+" "), RoleText.Text(ignore.String()))
+	}
+	return nil
+}
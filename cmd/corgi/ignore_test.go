@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"testing"
+	"time"
+)
+
+func TestIgnoreMatches(t *testing.T) {
+	alice := "alice!a@example.org"
+	tests := []struct {
+		ignore                   Ignore
+		prefix, msgType, channel string
+		want                     bool
+	}{
+		{Ignore{Mask: "alice!*@*"}, alice, "PRIVMSG", "#go", true},
+		{Ignore{Mask: "alice!*@*"}, "bob!b@example.org", "PRIVMSG", "#go", false},
+		{Ignore{Mask: "*!*@example.org", Types: []string{"JOIN", "PART"}}, alice, "PART", "#go", true},
+		{Ignore{Mask: "*!*@example.org", Types: []string{"JOIN", "PART"}}, alice, "PRIVMSG", "#go", false},
+		{Ignore{Mask: "alice!*@*", Channel: "#go"}, alice, "PRIVMSG", "#GO", true},
+		{Ignore{Mask: "alice!*@*", Channel: "#go"}, alice, "PRIVMSG", "#rust", false},
+		{Ignore{Mask: "alice!*@*", Expires: time.Now().Add(time.Hour)}, alice, "PRIVMSG", "#go", true},
+		{Ignore{Mask: "alice!*@*", Expires: time.Now().Add(-time.Second)}, alice, "PRIVMSG", "#go", false},
+	}
+	for _, test := range tests {
+		if got := test.ignore.matches(test.prefix, test.msgType, test.channel); got != test.want {
+			t.Errorf("%v matching %s %s on %s = %v, want %v", test.ignore, test.prefix, test.msgType, test.channel, got, test.want)
+		}
+	}
+}
+
+func TestMessageType(t *testing.T) {
+	tests := []struct{ command, message, want string }{
+		{"PRIVMSG", "hello", "PRIVMSG"},
+		{"PRIVMSG", "\x01ACTION waves\x01", "PRIVMSG"},
+		{"PRIVMSG", "\x01VERSION\x01", "CTCP"},
+		{"NOTICE", "\x01VERSION corgi\x01", "CTCP"},
+		{"NOTICE", "hello", "NOTICE"},
+		{"JOIN", "", "JOIN"},
+	}
+	for _, test := range tests {
+		if got := messageType(test.command, test.message); got != test.want {
+			t.Errorf("messageType(%s, %q) = %s, want %s", test.command, test.message, got, test.want)
+		}
+	}
+}
+
+func TestIgnores(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "alice", "bob")
+	fs.SetMembers("#rust", "alice")
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#rust")
+	join(t, sm, c, "#go")
+
+	input(sm, "/ignore alice PRIVMSG -channel #go")
+	input(sm, "/ignore bob NOTICE,INVITE")
+	c.Send(":alice!a@localhost PRIVMSG #go :hidden message")
+	c.Send(":alice!a@localhost PRIVMSG #go :\x01ACTION hides\x01")
+	c.Send(":alice!a@localhost NOTICE #go :shown notice")
+	c.Send(":bob!b@localhost NOTICE corgi :hidden notice")
+	c.Send(":bob!b@localhost INVITE corgi #secret")
+	c.Send(":alice!a@localhost INVITE corgi #club")
+	c.Send(":alice!a@localhost NOTICE corgi :last")
+	eventually(t, sm, "the last notice", func() bool { return ui.shows("-alice- last") })
+	sm.wait(func() {
+		for _, hidden := range []string{"hidden message", "hides", "hidden notice", "#secret"} {
+			if ui.shows(hidden) {
+				t.Errorf("showed %q from an ignored user", hidden)
+			}
+		}
+		for _, shown := range []string{"#go -alice- shown notice", "alice invited you to #club"} {
+			if !ui.shows(shown) {
+				t.Errorf("didn't show %q", shown)
+			}
+		}
+	})
+
+	// the PRIVMSG ignore only applies on #go
+	input(sm, "/channel #rust")
+	c.Send(":alice!a@localhost PRIVMSG #rust :not hidden here")
+	eventually(t, sm, "the message on #rust", func() bool { return ui.shows("not hidden here") })
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// how many lines of input history are kept for each buffer
+const maxHistory = 100
+
+// per-buffer input history, browsed with the up and down arrows. The input
+// goroutine browses and adds to it while the event loop switches buffers.
+type InputHistory struct {
+	mu     sync.Mutex
+	path   string
+	lines  map[string][]string // oldest first, keyed by buffer name
+	buffer string              // the buffer whose history is being browsed
+	pos    int                 // index into the buffer's lines, len(lines) when not browsing
+	draft  string              // what was typed before browsing started
+}
+
+// loads the history saved at path, starting empty if there isn't any
+func NewInputHistory(path string) *InputHistory {
+	h := InputHistory{
+		path:  path,
+		lines: make(map[string][]string)}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &h.lines)
+	}
+	return &h
+}
+
+// name used for the history of a channel, or of a server's status output
+// when channelName is empty
+func bufferName(socket, channelName string) string {
+	return strings.TrimSpace(socket + " " + channelName)
+}
+
+func (h *InputHistory) SwitchBuffer(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.buffer != name {
+		h.buffer = name
+		h.pos = len(h.lines[name])
+		h.draft = ""
+	}
+}
+
+func (h *InputHistory) Add(line string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lines := h.lines[h.buffer]
+	// don't bother remembering blank lines or immediate repeats
+	if strings.TrimSpace(line) != "" && (len(lines) == 0 || lines[len(lines)-1] != line) {
+		lines = append(lines, line)
+		if len(lines) > maxHistory {
+			lines = lines[len(lines)-maxHistory:]
+		}
+		h.lines[h.buffer] = lines
+	}
+	h.pos = len(lines)
+	h.draft = ""
+}
+
+// returns the line before the one being browsed, remembering the partially
+// typed line so Next can bring it back
+func (h *InputHistory) Prev(current string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lines := h.lines[h.buffer]
+	if h.pos == len(lines) {
+		h.draft = current
+	}
+	if h.pos > 0 {
+		h.pos--
+	}
+	if h.pos < len(lines) {
+		return lines[h.pos]
+	}
+	return current
+}
+
+func (h *InputHistory) Next() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lines := h.lines[h.buffer]
+	if h.pos < len(lines) {
+		h.pos++
+	}
+	if h.pos < len(lines) {
+		return lines[h.pos]
+	}
+	return h.draft
+}
+
+func (h *InputHistory) Save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, err := json.Marshal(h.lines)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0600)
+}
+
+// cycles through completions of the last word on the input line
+type Completer struct {
+	candidates func(word string, lineStart bool) []string
+	base       string   // the line with the word being completed removed
+	matches    []string // completions for the word as originally typed
+	idx        int
+	last       string // the line we last produced, to detect repeated tabs
+}
+
+func NewCompleter(candidates func(word string, lineStart bool) []string) *Completer {
+	return &Completer{candidates: candidates}
+}
+
+// returns the line with its last word completed. Pressing tab again on the
+// line we returned moves on to the next match.
+func (c *Completer) Complete(line string) string {
+	if line == c.last && len(c.matches) > 0 {
+		c.idx = (c.idx + 1) % len(c.matches)
+	} else {
+		wordStart := strings.LastIndex(line, " ") + 1
+		c.base = line[:wordStart]
+		word := line[wordStart:]
+		c.matches = nil
+		c.idx = 0
+		lineStart := strings.TrimSpace(c.base) == ""
+		for _, candidate := range c.candidates(word, lineStart) {
+			if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(word)) {
+				c.matches = append(c.matches, candidate)
+			}
+		}
+		if len(c.matches) == 0 {
+			c.last = ""
+			return line
+		}
+	}
+	c.last = c.base + c.matches[c.idx]
+	return c.last
+}
+
+// candidates for the completer: commands at the start of the line, channel
+// names for words starting with #, otherwise nicks in the current channel
+func (sm *ServerManager) completionCandidates(word string, lineStart bool) []string {
+	var candidates []string
+	switch {
+	case lineStart && strings.HasPrefix(word, "/"):
+		for name := range commandIndex {
+			candidates = append(candidates, "/"+name)
+		}
+		for name := range sm.config.Aliases {
+			candidates = append(candidates, "/"+name)
+		}
+		for _, script := range sm.scripts {
+			for name := range script.commands {
+				candidates = append(candidates, "/"+name)
+			}
+		}
+		sort.Strings(candidates)
+	case strings.HasPrefix(word, "#"):
+		if sm.current != nil {
+			for name := range sm.current.Channels {
+				candidates = append(candidates, name)
+			}
+			sort.Strings(candidates)
+		}
+	case sm.current != nil && sm.current.currentChannel != nil:
+		suffix := ""
+		if lineStart {
+			suffix = ": "
+		}
+		for _, nick := range sm.current.currentChannel.RecentNicks() {
+			candidates = append(candidates, nick+suffix)
+		}
+	}
+	return candidates
+}
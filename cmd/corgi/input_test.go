@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestInputHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	h := NewInputHistory(path)
+	h.SwitchBuffer("irc.example.org #go")
+	for _, line := range []string{"one", "two", "two", " ", "three"} {
+		h.Add(line)
+	}
+	// repeats and blank lines aren't kept
+	for _, want := range []string{"three", "two", "one", "one"} {
+		if got := h.Prev("draft"); got != want {
+			t.Errorf("Prev() = %q, want %q", got, want)
+		}
+	}
+	for _, want := range []string{"two", "three", "draft", "draft"} {
+		if got := h.Next(); got != want {
+			t.Errorf("Next() = %q, want %q", got, want)
+		}
+	}
+
+	// every buffer has its own history
+	h.SwitchBuffer("irc.example.org #rust")
+	if got := h.Prev("typed"); got != "typed" {
+		t.Errorf("Prev() in an empty buffer = %q, want the typed line back", got)
+	}
+	h.Add("cargo")
+
+	if err := h.Save(); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+	h = NewInputHistory(path)
+	h.SwitchBuffer("irc.example.org #go")
+	if got := h.Prev(""); got != "three" {
+		t.Errorf("Prev() after loading = %q, want three", got)
+	}
+	h.SwitchBuffer("irc.example.org #rust")
+	if got := h.Prev(""); got != "cargo" {
+		t.Errorf("Prev() after loading = %q, want cargo", got)
+	}
+}
+
+func TestInputHistoryLimit(t *testing.T) {
+	h := NewInputHistory(filepath.Join(t.TempDir(), "history.json"))
+	for idx := 0; idx < maxHistory+10; idx++ {
+		h.Add(string(rune('a'+idx%26)) + string(rune('a'+idx/26)))
+	}
+	count := 0
+	for prev := ""; ; count++ {
+		line := h.Prev(prev)
+		if line == prev {
+			break
+		}
+		prev = line
+	}
+	if count != maxHistory {
+		t.Errorf("kept %d lines, want %d", count, maxHistory)
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	c := NewCompleter(func(word string, lineStart bool) []string {
+		if lineStart {
+			return []string{"/join", "/help", "alice: ", "Albert: "}
+		}
+		return []string{"alice", "Albert", "bob"}
+	})
+	cases := []struct{ line, want string }{
+		{"/j", "/join"},
+		{"al", "alice: "},
+		// tabbing again on what we produced cycles through the matches
+		{"alice: ", "Albert: "},
+		{"Albert: ", "alice: "},
+		{"hi AL", "hi alice"},
+		{"hi alice", "hi Albert"},
+		{"hi zed", "hi zed"},
+		{"hi ", "hi alice"},
+	}
+	for _, c2 := range cases {
+		if got := c.Complete(c2.line); got != c2.want {
+			t.Errorf("Complete(%q) = %q, want %q", c2.line, got, c2.want)
+		}
+	}
+}
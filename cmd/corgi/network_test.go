@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"net"
+	"testing"
+)
+
+func TestNetworkPasswordAndPerform(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	t.Setenv("CORGI_TEST_PASSWORD", "hunter2")
+	t.Setenv("CORGI_TEST_NICKSERV", "secret")
+	sm.wait(func() {
+		sm.config.Networks = map[string]Network{
+			"test": {
+				Addr:        fs.Addr(),
+				PasswordEnv: "CORGI_TEST_PASSWORD",
+				Perform:     []string{"PRIVMSG NickServ :IDENTIFY $CORGI_TEST_NICKSERV", "MODE $nick +i"},
+				Channels:    []string{"#go"}},
+			"broken": {Addr: fs.Addr(), PasswordEnv: "CORGI_TEST_UNSET"}}
+	})
+
+	input(sm, "/connect broken")
+	eventually(t, sm, "the missing password reported", func() bool {
+		return ui.shows("CORGI_TEST_UNSET isn't set")
+	})
+
+	input(sm, "/connect test")
+	c := fs.NextConn()
+	c.Expect("PASS hunter2")
+	input(sm, "/nick corgi")
+	c.Expect("NICK corgi")
+	c.Expect("PRIVMSG NickServ :IDENTIFY secret")
+	c.Expect("MODE corgi +i")
+	c.Expect("JOIN #go")
+}
+
+func TestConnectProxyErrors(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	sm.wait(func() {
+		// nothing listens on port 1
+		sm.config.Networks = map[string]Network{"proxied": {Addr: fs.Addr(), Proxy: "socks5://127.0.0.1:1"}}
+	})
+
+	input(sm, "/connect -proxy ftp://localhost:21 irc.example.org")
+	input(sm, "/connect -bogus irc.example.org")
+	input(sm, "/connect proxied")
+	eventually(t, sm, "the proxy errors", func() bool {
+		return ui.shows("the scheme must be socks5 or http") &&
+			ui.shows("Usage: /connect [-tls] [-4|-6] [-bind <address>] [-proxy <url>] <host> [<port>]") &&
+			ui.shows("proxy 127.0.0.1:1: ")
+	})
+}
+
+func TestParseServer(t *testing.T) {
+	cases := []struct {
+		host, port string
+		tls        bool
+		want       string
+		wantTLS    bool
+		channel    string
+	}{
+		{"irc.example.org", "", false, "irc.example.org:6667", false, ""},
+		{"irc.example.org", "6668", false, "irc.example.org:6668", false, ""},
+		{"irc.example.org:6668", "", false, "irc.example.org:6668", false, ""},
+		{"irc.example.org", "", true, "irc.example.org:6697", true, ""},
+		{"2001:db8::1", "", false, "[2001:db8::1]:6667", false, ""},
+		{"[2001:db8::1]", "7000", false, "[2001:db8::1]:7000", false, ""},
+		{"[2001:db8::1]:7000", "", false, "[2001:db8::1]:7000", false, ""},
+		{"irc://irc.example.org", "", false, "irc.example.org:6667", false, ""},
+		{"ircs://irc.example.org/#go", "", false, "irc.example.org:6697", true, "#go"},
+		{"irc://[2001:db8::1]:7000/go,needkey", "", false, "[2001:db8::1]:7000", false, "#go"},
+	}
+	for _, c := range cases {
+		addr, useTLS, channelName, err := parseServer(c.host, c.port, c.tls)
+		if err != nil || addr != c.want || useTLS != c.wantTLS || channelName != c.channel {
+			t.Errorf("parseServer(%q, %q, %v) = %q, %v, %q, %v, want %q, %v, %q",
+				c.host, c.port, c.tls, addr, useTLS, channelName, err, c.want, c.wantTLS, c.channel)
+		}
+	}
+	for _, bad := range [][2]string{{"irc.example.org:6667", "6668"}, {"irc.example.org", "ircd"},
+		{"http://irc.example.org", ""}, {"irc.example.org:", ""}, {"irc.example.org", "70000"}} {
+		if addr, _, _, err := parseServer(bad[0], bad[1], false); err == nil {
+			t.Errorf("parseServer(%q, %q) = %q, want an error", bad[0], bad[1], addr)
+		}
+	}
+}
+
+func TestServersShowsRemoteAddr(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	_, port, _ := net.SplitHostPort(fs.Addr())
+	input(sm, "/connect -4 -bind 127.0.0.1 irc://localhost:"+port)
+	fs.NextConn().Expect("USER")
+	input(sm, "/servers")
+	eventually(t, sm, "the resolved address", func() bool { return ui.shows("localhost:" + port + " (" + fs.Addr() + ")") })
+}
+
+func TestConnectDoesntBlock(t *testing.T) {
+	sm, ui := newTestManager(t)
+	// a proxy that never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	input(sm, "/connect -proxy http://"+listener.Addr().String()+" irc.example.org")
+	input(sm, "/servers")
+	sm.wait(func() {
+		if !ui.shows("[connecting]") {
+			t.Errorf("the server isn't listed as connecting")
+		}
+	})
+	input(sm, "/disconnect")
+	sm.wait(func() {
+		if len(sm.servers) != 0 || sm.current != nil {
+			t.Errorf("the server should be off the server list")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc"
+	"hash/fnv"
+	"strings"
+)
+
+// the colors nicks can be picked from, leaving out the ones that are hard to
+// tell from the background, whatever it is
+var nickHues = []Hue{
+	HueRed, HueGreen, HueYellow, HueBlue, HueMagenta, HueCyan,
+	HueLightRed, HueLightGreen, HueLightYellow, HueLightBlue, HueLightMagenta, HueLightCyan}
+
+// the colors theme doesn't use for anything else, so a nick is never
+// mistaken for our own, a server or an error. None if the theme has no
+// colors at all, like mono.
+func themeNickColors(theme Theme) []Style {
+	used := make(map[Hue]bool)
+	for role, style := range bundledThemes["default"] {
+		if themed, ok := theme[role]; ok {
+			style = themed
+		}
+		used[style.Hue] = true
+		used[style.Background] = true
+	}
+	if len(used) == 1 && used[HueDefault] {
+		return nil
+	}
+	var palette []Style
+	for _, hue := range nickHues {
+		if !used[hue] {
+			palette = append(palette, Style{Hue: hue})
+		}
+	}
+	return palette
+}
+
+// how nicks are colored, parsed from the config
+type nickColors struct {
+	palette   []Style
+	overrides map[string]Style // by lowercased nick
+}
+
+// parses the config's nick colors, reporting the ones that don't parse, or
+// picks them to suit the theme if the config doesn't say
+func (sm *ServerManager) loadNickColors() {
+	sm.nickColors = nickColors{overrides: make(map[string]Style)}
+	if sm.config.NickColors == nil {
+		sm.nickColors.palette = themeNickColors(sm.theme)
+	}
+	for _, str := range sm.config.NickColors {
+		if style, err := ParseStyle(str); err != nil {
+			sm.err("Ignoring nick color: " + err.Error())
+		} else {
+			sm.nickColors.palette = append(sm.nickColors.palette, style)
+		}
+	}
+	for nick, str := range sm.config.NickColorOverrides {
+		if style, err := ParseStyle(str); err != nil {
+			sm.err("Ignoring nick color for " + nick + ": " + err.Error())
+		} else {
+			sm.nickColors.overrides[strings.ToLower(nick)] = style
+		}
+	}
+}
+
+// the style for nick: its override, or a color picked by a hash of it so
+// it's the same every time. ok is false if nick coloring is off.
+func (colors nickColors) style(nick string) (style Style, ok bool) {
+	nick = strings.ToLower(nick)
+	if style, ok := colors.overrides[nick]; ok {
+		return style, true
+	}
+	if len(colors.palette) == 0 {
+		return Style{}, false
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(nick))
+	return colors.palette[hash.Sum32()%uint32(len(colors.palette))], true
+}
+
+// text drawn in nick's color, or as our own nick if it's ours on ic
+func (sm *ServerManager) nickText(ic *IrcServer, nick string, text string) Segment {
+	if ic != nil && strings.EqualFold(nick, ic.Nick) {
+		return RoleOwnNick.Text(text)
+	}
+	style, ok := sm.nickColors.style(nick)
+	if !ok {
+		return RoleNick.Text(text)
+	}
+	return Segment{Text: text, Hue: style.Hue, Background: style.Background, Attrs: style.Attrs, Role: RoleNick}
+}
+
+// characters that can be part of a nick, besides letters and digits
+const nickSpecials = "[]\\`_^{|}-"
+
+func isNickChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.IndexByte(nickSpecials, c) >= 0
+}
+
+// colors the nicks of channel's members wherever they're mentioned in the
+// plain text of segments
+func (sm *ServerManager) colorMentions(ic *IrcServer, channel *irc.Channel, segments []Segment) []Segment {
+	if channel == nil {
+		return segments
+	}
+	var colored []Segment
+	for _, segment := range segments {
+		// leave text that's already styled, e.g. with mIRC colors, alone
+		if segment.Role != RoleText || segment.Hue != HueDefault {
+			colored = append(colored, segment)
+			continue
+		}
+		text := segment.Text
+		start := 0
+		for idx := 0; idx <= len(text); idx++ {
+			if idx < len(text) && isNickChar(text[idx]) {
+				continue
+			}
+			word := text[start:idx]
+			if word != "" && channel.Nicks[word] {
+				if start > 0 {
+					before := segment
+					before.Text = text[:start]
+					colored = append(colored, before)
+				}
+				mention := sm.nickText(ic, word, word)
+				mention.Attrs |= segment.Attrs
+				colored = append(colored, mention)
+				text = text[idx:]
+				idx = 0
+			}
+			start = idx + 1
+		}
+		if text != "" {
+			segment.Text = text
+			colored = append(colored, segment)
+		}
+	}
+	return colored
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc"
+	"testing"
+)
+
+func TestNickColors(t *testing.T) {
+	sm, _ := newTestManager(t)
+	sm.wait(func() {
+		sm.config.NickColorOverrides = map[string]string{"Bob": "bold red"}
+		sm.loadNickColors()
+		ic := &IrcServer{Server: irc.NewServer("irc.example.org:6667", "me", "me", "me")}
+		if a, b := sm.nickText(ic, "alice", ""), sm.nickText(ic, "ALICE", ""); a != b || a.Hue == HueDefault {
+			t.Errorf("alice is drawn as %+v and %+v, want the same color", a, b)
+		}
+		if got := sm.nickText(ic, "bob", ""); got.Hue != HueRed || got.Attrs != AttrBold {
+			t.Errorf("bob is drawn as %+v, want his override", got)
+		}
+		if got := sm.nickText(ic, "Me", ""); got.Role != RoleOwnNick {
+			t.Errorf("our own nick is drawn as %+v", got)
+		}
+
+		channel := irc.NewChannel("#test")
+		channel.Nicks["alice"] = true
+		got := sm.colorMentions(ic, channel, []Segment{RoleText.Text("hi alice, not alicex")})
+		want := []string{"hi ", "alice", ", not alicex"}
+		if len(got) != len(want) {
+			t.Fatalf("mentions split into %+v, want %q", got, want)
+		}
+		for idx := range want {
+			if got[idx].Text != want[idx] {
+				t.Errorf("segment %d is %q, want %q", idx, got[idx].Text, want[idx])
+			}
+		}
+		if got[1].Role != RoleNick || got[1].Hue != sm.nickText(ic, "alice", "").Hue {
+			t.Errorf("mention is drawn as %+v, want alice's color", got[1])
+		}
+	})
+}
+
+func TestThemeNickColors(t *testing.T) {
+	for name, theme := range bundledThemes {
+		palette := themeNickColors(theme)
+		if name == "mono" {
+			if len(palette) != 0 {
+				t.Errorf("mono picks nick colors %+v, want none", palette)
+			}
+			continue
+		}
+		if len(palette) == 0 {
+			t.Errorf("%s leaves no colors for nicks", name)
+		}
+		for _, style := range palette {
+			for role, roleStyle := range theme {
+				if roleStyle.Hue == style.Hue || roleStyle.Background == style.Hue {
+					t.Errorf("%s colors nicks like %s", name, role)
+				}
+			}
+		}
+	}
+	// a theme that only sets a few roles keeps the default's colors for the
+	// rest, so those are taken too
+	partial := themeNickColors(Theme{RoleOwnNick: {Hue: HueCyan}})
+	for _, style := range partial {
+		if style.Hue == HueCyan || style.Hue == HueMagenta || style.Hue == HueRed {
+			t.Errorf("a partial theme colors nicks %v, which a role has", style.Hue)
+		}
+	}
+
+	sm, _ := newTestManager(t)
+	ic := &IrcServer{Server: irc.NewServer("irc.example.org:6667", "me", "me", "me")}
+	input(sm, "/theme mono")
+	sm.wait(func() {
+		if got := sm.nickText(ic, "alice", ""); got.Hue != HueDefault {
+			t.Errorf("alice is drawn as %+v in mono, want no color", got)
+		}
+	})
+	input(sm, "/theme default")
+	sm.wait(func() {
+		if got := sm.nickText(ic, "alice", ""); got.Hue == HueDefault || got.Hue == HueLightMagenta || got.Hue == HueMagenta {
+			t.Errorf("alice is drawn as %+v in the default theme", got)
+		}
+		// an empty list in the config turns coloring off whatever the theme
+		sm.config.NickColors = []string{}
+		sm.loadNickColors()
+		if got := sm.nickText(ic, "alice", ""); got.Hue != HueDefault {
+			t.Errorf("alice is drawn as %+v with nick colors off", got)
+		}
+	})
+}
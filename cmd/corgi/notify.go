@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"github.com/natemealey/corgi/irc"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// a way of getting the user's attention when corgi isn't in front of them
+type Notifier interface {
+	Notify(title, message string) error
+}
+
+// rings the terminal bell, which most terminals turn into an urgency hint
+type bellNotifier struct {
+	ui Ui
+}
+
+func (n bellNotifier) Notify(title, message string) error {
+	n.ui.Alert("\a")
+	return nil
+}
+
+// a desktop notification through the terminal: OSC 9 as iTerm2, kitty and
+// others understand it, or OSC 777 as rxvt and VTE based terminals do
+type oscNotifier struct {
+	ui   Ui
+	code int
+}
+
+func (n oscNotifier) Notify(title, message string) error {
+	seq := "\x1b]9;" + title + ": " + message + "\a"
+	if n.code == 777 {
+		// fields are separated by semicolons, so there can't be any in them
+		title = strings.ReplaceAll(title, ";", ",")
+		seq = "\x1b]777;notify;" + title + ";" + message + "\a"
+	}
+	n.ui.Alert(seq)
+	return nil
+}
+
+// runs a command with the title and message as its last two arguments, e.g.
+// notify-send
+type commandNotifier struct {
+	args []string
+}
+
+func (n commandNotifier) Notify(title, message string) error {
+	if len(n.args) == 0 {
+		return errors.New("No notify_command set!")
+	}
+	cmd := exec.Command(n.args[0], append(n.args[1:], title, message)...)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// reap it without holding anything up
+	go cmd.Wait()
+	return nil
+}
+
+// the notifiers the config asks for
+func (sm *ServerManager) loadNotifiers() {
+	sm.notifiers = nil
+	for _, name := range sm.config.Notify {
+		switch name {
+		case "bell":
+			sm.notifiers = append(sm.notifiers, bellNotifier{sm.ui})
+		case "osc9":
+			sm.notifiers = append(sm.notifiers, oscNotifier{sm.ui, 9})
+		case "osc777":
+			sm.notifiers = append(sm.notifiers, oscNotifier{sm.ui, 777})
+		case "command":
+			sm.notifiers = append(sm.notifiers, commandNotifier{sm.config.NotifyCommand})
+		default:
+			sm.err("Unknown notifier `" + name + "`, must be bell, osc9, osc777 or command")
+		}
+	}
+}
+
+// whether text mentions nick as a word of its own
+func mentions(text, nick string) bool {
+	if nick == "" {
+		return false
+	}
+	text, nick = strings.ToLower(text), strings.ToLower(nick)
+	for start := 0; ; {
+		idx := strings.Index(text[start:], nick)
+		if idx < 0 {
+			return false
+		}
+		idx += start
+		end := idx + len(nick)
+		if (idx == 0 || !isNickChar(text[idx-1])) && (end == len(text) || !isNickChar(text[end])) {
+			return true
+		}
+		start = idx + 1
+	}
+}
+
+// whether a message to recipient deserves a notification: it's private, a
+// highlight or has one of the config's keywords in it
+func (sm *ServerManager) shouldNotify(recipient, text string, highlight bool) bool {
+	if !irc.IsChannel(recipient) || highlight {
+		return true
+	}
+	lowerText := strings.ToLower(text)
+	for _, keyword := range sm.config.NotifyKeywords {
+		if keyword != "" && strings.Contains(lowerText, strings.ToLower(keyword)) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifies the user of a message from sender if shouldNotify says so. Nothing is sent while we're away, or
+// sooner than the config's notify interval after the last notification.
+func (sm *ServerManager) notifyMessage(ic *IrcServer, sender, recipient, text string, highlight bool) {
+	if len(sm.notifiers) == 0 || ic.Away || recipient == "" {
+		return
+	}
+	text = stripFormatting(strings.TrimSuffix(strings.TrimPrefix(text, "\x01ACTION "), "\x01"))
+	if !sm.shouldNotify(recipient, text, highlight) {
+		return
+	}
+	interval := time.Duration(sm.config.NotifyInterval) * time.Second
+	if time.Since(sm.lastNotified) < interval {
+		return
+	}
+	sm.lastNotified = time.Now()
+	title := sender
+	if recipient != ic.Nick {
+		title += " in " + recipient
+	}
+	for _, notifier := range sm.notifiers {
+		if err := notifier.Notify(stripControls(title), stripControls(text)); err != nil {
+			sm.err("Failed to notify! Error is: " + err.Error())
+		}
+	}
+}
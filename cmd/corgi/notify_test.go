@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"corgi: hi", true},
+		{"hi Corgi!", true},
+		{"corgis are great", false},
+		{"notcorgi", false},
+		{"ask corgi_ or corgi", true},
+	}
+	for _, test := range tests {
+		if got := mentions(test.text, "corgi"); got != test.want {
+			t.Errorf("mentions(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	sm, ui := newTestManager(t)
+	sm.wait(func() {
+		sm.config.Notify = []string{"bell", "osc777"}
+		sm.config.NotifyKeywords = []string{"release"}
+		sm.config.NotifyInterval = 0
+		sm.loadNotifiers()
+	})
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "alice")
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+
+	notified := func(what, want string) {
+		t.Helper()
+		eventually(t, sm, what, func() bool { return ui.alerts != "" })
+		sm.wait(func() {
+			if ui.alerts != want {
+				t.Errorf("notified of %s with %q, want %q", what, ui.alerts, want)
+			}
+			ui.alerts = ""
+		})
+	}
+	c.Send(":alice!alice@localhost PRIVMSG #go :nothing to see")
+	c.Send(":alice!alice@localhost PRIVMSG #go :hey corgi\x1b]0;evil\a")
+	notified("a highlight", "\a\x1b]777;notify;alice in #go;hey corgi]0;evil\a")
+	c.Send(":alice!alice@localhost PRIVMSG corgi :psst")
+	notified("a private message", "\a\x1b]777;notify;alice;psst\a")
+	c.Send(":alice!alice@localhost PRIVMSG #go :the \x02release\x02 is out")
+	notified("a keyword", "\a\x1b]777;notify;alice in #go;the release is out\a")
+
+	c.Send(":server 306 corgi :You have been marked as being away")
+	eventually(t, sm, "being marked away", func() bool { return sm.current.Away })
+	c.Send(":alice!alice@localhost PRIVMSG corgi :are you there?")
+	c.Send(":alice!alice@localhost PRIVMSG #go :corgi, anyone?")
+	eventually(t, sm, "the messages while away", func() bool { return ui.shows("corgi, anyone?") })
+	sm.wait(func() {
+		if ui.alerts != "" {
+			t.Errorf("notified while away with %q", ui.alerts)
+		}
+	})
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"github.com/natemealey/corgi/irc"
+	lua "github.com/yuin/gopher-lua"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// events a script can hook with corgi.hook(event, fn)
+var scriptEvents = map[string]bool{
+	// fn(server, prefix, command, args, line) before corgi shows a line from a
+	// server, returning true hides the line
+	"message": true,
+	// fn(server, prefix, command, args, line) after corgi has shown it
+	"after_message": true,
+	// fn(input) for each line the user enters, returning a string replaces
+	// the line and returning false drops it
+	"input": true,
+}
+
+// a plugin loaded from a Lua file, along with everything it registered. Like
+// the rest of ServerManager, scripts are only run from the event loop.
+type Script struct {
+	name      string
+	path      string
+	state     *lua.LState
+	hooks     map[string][]*lua.LFunction
+	commands  map[string]*lua.LFunction
+	timers    map[int]*time.Timer
+	nextTimer int
+	unloaded  bool
+}
+
+// the directory scripts are loaded from at startup
+func pluginDir() string {
+	return configPath("plugins")
+}
+
+// name a script is known by, from its file name
+func scriptName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".lua")
+}
+
+// calls fn, returning its first result
+func (script *Script) call(fn *lua.LFunction, args ...lua.LValue) (lua.LValue, error) {
+	if script.unloaded {
+		return lua.LNil, nil
+	}
+	if err := script.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args...); err != nil {
+		return lua.LNil, err
+	}
+	ret := script.state.Get(-1)
+	script.state.Pop(1)
+	return ret, nil
+}
+
+func (script *Script) unload() {
+	for _, timer := range script.timers {
+		timer.Stop()
+	}
+	script.unloaded = true
+	script.state.Close()
+}
+
+func (sm *ServerManager) loadScripts() {
+	paths, _ := filepath.Glob(filepath.Join(pluginDir(), "*.lua"))
+	for _, path := range paths {
+		if err := sm.loadScript(path); err != nil {
+			sm.err(err.Error())
+		}
+	}
+}
+
+// loads the script at path, replacing any loaded script with the same name
+func (sm *ServerManager) loadScript(path string) error {
+	name := scriptName(path)
+	if _, err := os.Stat(path); err != nil {
+		return errors.New("Can't find script " + path + "!")
+	}
+	script := &Script{
+		name:     name,
+		path:     path,
+		state:    lua.NewState(),
+		hooks:    make(map[string][]*lua.LFunction),
+		commands: make(map[string]*lua.LFunction),
+		timers:   make(map[int]*time.Timer)}
+	script.state.SetGlobal("corgi", sm.scriptApi(script))
+	if err := script.state.DoFile(path); err != nil {
+		script.unload()
+		return errors.New("Failed to load script " + name + "! Error is: " + err.Error())
+	}
+	if old := sm.scripts[name]; old != nil {
+		old.unload()
+	}
+	sm.scripts[name] = script
+	sm.success("Loaded script " + name)
+	return nil
+}
+
+func (sm *ServerManager) unloadScript(name string) error {
+	script := sm.scripts[name]
+	if script == nil {
+		return errors.New("No script named " + name + " is loaded!")
+	}
+	script.unload()
+	delete(sm.scripts, name)
+	sm.info("Unloaded script " + name)
+	return nil
+}
+
+// loaded scripts in name order, so hooks always run in the same order
+func (sm *ServerManager) sortedScripts() []*Script {
+	names := make([]string, 0, len(sm.scripts))
+	for name := range sm.scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	scripts := make([]*Script, len(names))
+	for idx, name := range names {
+		scripts[idx] = sm.scripts[name]
+	}
+	return scripts
+}
+
+// runs the message hooks for a line from ic, returning whether a script
+// hid it
+func (sm *ServerManager) scriptMessageHooks(event string, ic *IrcServer, ev *irc.Event) bool {
+	dropped := false
+	for _, script := range sm.sortedScripts() {
+		for _, fn := range script.hooks[event] {
+			argTable := script.state.NewTable()
+			for _, arg := range ev.Params {
+				argTable.Append(lua.LString(arg))
+			}
+			ret, err := script.call(fn, lua.LString(ic.Addr), lua.LString(ev.Prefix),
+				lua.LString(ev.Command), argTable, lua.LString(ev.Raw))
+			if err != nil {
+				sm.err("Script " + script.name + " failed in " + event + " hook: " + err.Error())
+			} else if ret == lua.LTrue {
+				dropped = true
+			}
+		}
+	}
+	return dropped
+}
+
+// runs the input hooks, returning the possibly rewritten input and whether
+// it should still be handled
+func (sm *ServerManager) scriptInputHooks(input string) (string, bool) {
+	for _, script := range sm.sortedScripts() {
+		for _, fn := range script.hooks["input"] {
+			ret, err := script.call(fn, lua.LString(input))
+			if err != nil {
+				sm.err("Script " + script.name + " failed in input hook: " + err.Error())
+			} else if ret == lua.LFalse {
+				return input, false
+			} else if ret.Type() == lua.LTString {
+				input = lua.LVAsString(ret)
+			}
+		}
+	}
+	return input, true
+}
+
+// finds the script that registered the command, if any
+func (sm *ServerManager) scriptCommand(cmd string) (*Script, *lua.LFunction) {
+	for _, script := range sm.sortedScripts() {
+		if fn := script.commands[cmd]; fn != nil {
+			return script, fn
+		}
+	}
+	return nil, nil
+}
+
+// a script command may return a string to report an error
+func (sm *ServerManager) runScriptCommand(script *Script, fn *lua.LFunction, args string) error {
+	ret, err := script.call(fn, lua.LString(args))
+	if err != nil {
+		return errors.New("Script " + script.name + " failed: " + err.Error())
+	}
+	if ret.Type() == lua.LTString {
+		return errors.New(lua.LVAsString(ret))
+	}
+	return nil
+}
+
+// /script load|unload|reload <name>, /script list
+func (sm *ServerManager) scriptCmd(args string) error {
+	strs := strings.Fields(args)
+	if len(strs) == 1 && strs[0] == "list" {
+		if len(sm.scripts) == 0 {
+			sm.info("No scripts loaded")
+			return nil
+		}
+		sm.info("All loaded scripts:")
+		for _, script := range sm.sortedScripts() {
+			sm.output(RoleItem.Text("  "+script.name), RoleNote.Text(" "+script.path))
+		}
+		return nil
+	}
+	if len(strs) != 2 {
+		return errors.New("Usage: /script load|unload|reload <name>, or /script list")
+	}
+	name := strs[1]
+	switch strs[0] {
+	case "load":
+		path := name
+		// bare names are looked up in the plugins directory
+		if !strings.ContainsRune(name, filepath.Separator) {
+			path = filepath.Join(pluginDir(), strings.TrimSuffix(name, ".lua")+".lua")
+		}
+		return sm.loadScript(path)
+	case "unload":
+		return sm.unloadScript(name)
+	case "reload":
+		script := sm.scripts[name]
+		if script == nil {
+			return errors.New("No script named " + name + " is loaded!")
+		}
+		return sm.loadScript(script.path)
+	}
+	return errors.New("Usage: /script load|unload|reload <name>, or /script list")
+}
+
+// builds the `corgi` table a script uses to talk to the client
+func (sm *ServerManager) scriptApi(script *Script) *lua.LTable {
+	L := script.state
+	api := L.NewTable()
+	fns := map[string]lua.LGFunction{
+		// corgi.hook(event, fn)
+		"hook": func(L *lua.LState) int {
+			event := L.CheckString(1)
+			if !scriptEvents[event] {
+				L.ArgError(1, "unknown event "+event)
+			}
+			script.hooks[event] = append(script.hooks[event], L.CheckFunction(2))
+			return 0
+		},
+		// corgi.command(name, fn), fn receives the argument string
+		"command": func(L *lua.LState) int {
+			script.commands[strings.TrimPrefix(L.CheckString(1), "/")] = L.CheckFunction(2)
+			return 0
+		},
+		// corgi.timer(seconds, fn[, repeat]) returns an id for corgi.cancel
+		"timer": func(L *lua.LState) int {
+			delay := time.Duration(float64(L.CheckNumber(1)) * float64(time.Second))
+			fn := L.CheckFunction(2)
+			repeat := L.OptBool(3, false)
+			script.nextTimer++
+			id := script.nextTimer
+			// timers fire on their own goroutine, so hand the call to the event loop
+			var fire func()
+			fire = func() {
+				if script.unloaded || script.timers[id] == nil {
+					return
+				}
+				if _, err := script.call(fn); err != nil {
+					sm.err("Script " + script.name + " failed in timer: " + err.Error())
+				}
+				if repeat && !script.unloaded && script.timers[id] != nil {
+					script.timers[id] = time.AfterFunc(delay, func() { sm.post(fire) })
+				} else {
+					delete(script.timers, id)
+				}
+			}
+			script.timers[id] = time.AfterFunc(delay, func() { sm.post(fire) })
+			L.Push(lua.LNumber(id))
+			return 1
+		},
+		// corgi.cancel(id)
+		"cancel": func(L *lua.LState) int {
+			id := L.CheckInt(1)
+			if timer := script.timers[id]; timer != nil {
+				timer.Stop()
+				delete(script.timers, id)
+			}
+			return 0
+		},
+		// corgi.send(line[, server]) sends a raw line
+		"send": func(L *lua.LState) int {
+			line := L.CheckString(1)
+			if ic := sm.scriptServer(L.OptString(2, "")); ic != nil {
+				ic.Send(line)
+			} else {
+				L.RaiseError("not connected to that server")
+			}
+			return 0
+		},
+		// corgi.print(text[, kind]) where kind is info, err, warn, success or note
+		"print": func(L *lua.LState) int {
+			text := L.CheckString(1)
+			switch L.OptString(2, "") {
+			case "info":
+				sm.info(text)
+			case "err":
+				sm.err(text)
+			case "warn":
+				sm.warn(text)
+			case "success":
+				sm.success(text)
+			case "note":
+				sm.note(text)
+			default:
+				sm.output(RoleText.Text(text))
+			}
+			return 0
+		},
+		// corgi.servers() lists every connected server
+		"servers": func(L *lua.LState) int {
+			servers := L.NewTable()
+			for _, ic := range sm.servers {
+				servers.Append(lua.LString(ic.Addr))
+			}
+			L.Push(servers)
+			return 1
+		},
+		// corgi.server() is the current server, or nil
+		"server": func(L *lua.LState) int {
+			if sm.current == nil {
+				L.Push(lua.LNil)
+			} else {
+				L.Push(lua.LString(sm.current.Addr))
+			}
+			return 1
+		},
+		// corgi.nick([server]) is our nick on the server, the current one by
+		// default, or nil
+		"nick": func(L *lua.LState) int {
+			if ic := sm.scriptServer(L.OptString(1, "")); ic != nil {
+				L.Push(lua.LString(ic.Nick))
+			} else {
+				L.Push(lua.LNil)
+			}
+			return 1
+		},
+		// corgi.channel([server]) is the current channel, or nil
+		"channel": func(L *lua.LState) int {
+			if ic := sm.scriptServer(L.OptString(1, "")); ic != nil && ic.currentChannel != nil {
+				L.Push(lua.LString(ic.currentChannel.Name))
+			} else {
+				L.Push(lua.LNil)
+			}
+			return 1
+		},
+		// corgi.channels([server]) lists the channels we're on
+		"channels": func(L *lua.LState) int {
+			channels := L.NewTable()
+			if ic := sm.scriptServer(L.OptString(1, "")); ic != nil {
+				for name := range ic.Channels {
+					channels.Append(lua.LString(name))
+				}
+			}
+			L.Push(channels)
+			return 1
+		},
+		// corgi.nicks(channel[, server]) lists the nicks on a channel
+		"nicks": func(L *lua.LState) int {
+			nicks := L.NewTable()
+			channelName := L.CheckString(1)
+			if ic := sm.scriptServer(L.OptString(2, "")); ic != nil && ic.Channels[channelName] != nil {
+				for _, nick := range ic.Channels[channelName].SortedNicks() {
+					nicks.Append(lua.LString(nick))
+				}
+			}
+			L.Push(nicks)
+			return 1
+		},
+	}
+	for name, fn := range fns {
+		L.SetField(api, name, L.NewFunction(fn))
+	}
+	return api
+}
+
+// the server a script asked for by socket, or the current one
+func (sm *ServerManager) scriptServer(socket string) *IrcServer {
+	if socket == "" {
+		return sm.current
+	}
+	for _, ic := range sm.servers {
+		if ic.Addr == socket {
+			return ic
+		}
+	}
+	return nil
+}
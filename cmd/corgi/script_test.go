@@ -0,0 +1,159 @@
+package main
+
+import (
+	"github.com/natemealey/corgi/irc/irctest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writes a script to the plugins directory and loads it
+func loadTestScript(t *testing.T, sm *ServerManager, name, source string) {
+	t.Helper()
+	if err := os.MkdirAll(pluginDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pluginDir(), name+".lua"), []byte(source), 0600); err != nil {
+		t.Fatal(err)
+	}
+	input(sm, "/script load "+name)
+}
+
+func TestScriptHooks(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+	join(t, sm, c, "#go")
+	loadTestScript(t, sm, "filter", `
+		local seen = 0
+		corgi.hook("message", function(server, prefix, command, args, line)
+			return command == "PRIVMSG" and args[2] == "buy now"
+		end)
+		corgi.hook("after_message", function(server, prefix, command, args, line)
+			if command == "PRIVMSG" then
+				seen = seen + 1
+				corgi.print("seen " .. seen .. " from " .. prefix)
+			end
+		end)
+		corgi.hook("input", function(input)
+			if input == "brb" then return "/away be right back" end
+			if input == "secret" then return false end
+		end)
+	`)
+	eventually(t, sm, "the script loading", func() bool { return ui.shows("Loaded script filter") })
+
+	c.Send(":spammer!s@localhost PRIVMSG #go :buy now")
+	c.Send(":alice!a@localhost PRIVMSG #go :hello")
+	eventually(t, sm, "the hooks running", func() bool { return ui.shows("seen 1 from alice!a@localhost") })
+	sm.wait(func() {
+		if ui.shows("buy now") || ui.shows("seen 2") {
+			t.Errorf("the hidden message was shown or passed on")
+		}
+		if !ui.shows("hello") {
+			t.Errorf("the message the hook let through wasn't shown")
+		}
+	})
+
+	input(sm, "secret")
+	input(sm, "brb")
+	c.Expect("AWAY :be right back")
+	sm.wait(func() {
+		if ui.shows("secret") {
+			t.Errorf("the dropped input was handled")
+		}
+	})
+}
+
+func TestScriptCommands(t *testing.T) {
+	sm, ui := newTestManager(t)
+	fs := irctest.NewServer(t)
+	c := connect(t, sm, fs)
+	loadTestScript(t, sm, "shout", `
+		corgi.command("/shout", function(args)
+			if args == "" then return "Nothing to shout!" end
+			corgi.send("PRIVMSG #go :" .. string.upper(args))
+		end)
+		corgi.command("broken", function(args) error("oops") end)
+	`)
+	input(sm, "/shout hello")
+	c.Expect("PRIVMSG #go :HELLO")
+	input(sm, "/shout")
+	input(sm, "/broken")
+	input(sm, "/help")
+	eventually(t, sm, "the command's errors and help", func() bool {
+		return ui.shows("Nothing to shout!") && ui.shows("Script shout failed") && ui.shows("/broken /shout")
+	})
+
+	input(sm, "/script unload shout")
+	input(sm, "/shout again")
+	eventually(t, sm, "the command going away", func() bool { return ui.shows("shout is an unrecognized command") })
+}
+
+func TestScriptTimers(t *testing.T) {
+	sm, ui := newTestManager(t)
+	loadTestScript(t, sm, "ticker", `
+		local ticks = 0
+		local id
+		id = corgi.timer(0.01, function()
+			ticks = ticks + 1
+			corgi.print("tick " .. ticks)
+			if ticks == 3 then corgi.cancel(id) end
+		end, true)
+		corgi.timer(0.01, function() corgi.print("once") end)
+		corgi.timer(0.5, function() corgi.print("too late") end)
+	`)
+	eventually(t, sm, "the timers firing", func() bool { return ui.shows("tick 3") && ui.shows("once") })
+	time.Sleep(100 * time.Millisecond)
+	// only what's shown after unloading counts, however slow we were to get here
+	sm.wait(func() {
+		if ui.shows("tick 4") {
+			t.Errorf("the cancelled timer kept repeating")
+		}
+		sm.processCommand("script", "unload ticker")
+		ui.lines = nil
+	})
+	time.Sleep(500 * time.Millisecond)
+	sm.wait(func() {
+		if ui.shows("too late") {
+			t.Errorf("a timer fired after its script was unloaded")
+		}
+	})
+}
+
+func TestScriptReload(t *testing.T) {
+	sm, ui := newTestManager(t)
+	loadTestScript(t, sm, "version", `
+		corgi.command("version", function() corgi.print("version one") end)
+		corgi.hook("input", function(input) if input == "old" then return false end end)
+	`)
+	input(sm, "/version")
+	eventually(t, sm, "the first version", func() bool { return ui.shows("version one") })
+
+	source := `corgi.command("version", function() corgi.print("version two") end)`
+	if err := os.WriteFile(filepath.Join(pluginDir(), "version.lua"), []byte(source), 0600); err != nil {
+		t.Fatal(err)
+	}
+	input(sm, "/script reload version")
+	input(sm, "/version")
+	eventually(t, sm, "the second version", func() bool { return ui.shows("version two") })
+	// the old input hook went with the old version
+	input(sm, "old")
+	eventually(t, sm, "the old hook being gone", func() bool { return ui.shows("Not on any server") })
+
+	if err := os.WriteFile(filepath.Join(pluginDir(), "version.lua"), []byte("this isn't lua"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	input(sm, "/script reload version")
+	input(sm, "/version")
+	eventually(t, sm, "a failed reload keeping the loaded version", func() bool {
+		count := 0
+		for _, line := range ui.lines {
+			if strings.Contains(line, "version two") {
+				count++
+			}
+		}
+		return ui.shows("Failed to load script version") && count == 2
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// shows and logs the PRIVMSG texts we just sent
+func (sm *ServerManager) echoMessages(target string, texts []string) {
+	for _, text := range texts {
+		sm.showMessage(sm.current, sm.current.Nick, target, text, false)
+	}
+}
+
+// /me <action> in the current channel
+func (sm *ServerManager) action(args string) error {
+	if sm.current.currentChannel == nil {
+		return errors.New("No current channel selected!")
+	}
+	if strings.TrimSpace(args) == "" {
+		return errors.New("Usage: /me <action>")
+	}
+	target := sm.current.currentChannel.Name
+	sm.echoMessages(target, sm.current.SendAction(target, args))
+	return nil
+}
+
+// /notice <target> <text>
+func (sm *ServerManager) notice(args string) error {
+	strs := strings.SplitN(args, " ", 2)
+	if len(strs) < 2 {
+		return errors.New("Must specify a target and notice text!")
+	}
+	for _, text := range sm.current.SendText("NOTICE", strs[0], strs[1]) {
+		line := []Segment{RoleChannel.Text(strs[0] + " "), RoleOwnNick.Text("-" + sm.current.Nick + "- ")}
+		sm.output(append(line, sm.formatText(text, RoleText.Text(""))...)...)
+	}
+	return nil
+}
+
+// handles input that may be several pasted lines, asking before sending more
+// than the configured number of them
+func (sm *ServerManager) handlePaste(input string) {
+	lines := strings.Split(strings.TrimRight(input, "\r\n"), "\n")
+	if sm.config.PasteThreshold > 0 && len(lines) > sm.config.PasteThreshold {
+		sm.pendingPaste = lines
+		sm.warn("About to send " + strconv.Itoa(len(lines)) +
+			" lines. Enter `/paste` to send them or `/paste cancel` to drop them.")
+		return
+	}
+	for _, line := range lines {
+		sm.handleInputLine(strings.TrimRight(line, "\r"))
+	}
+}
+
+// /paste sends the paste waiting for confirmation, /paste cancel drops it
+func (sm *ServerManager) confirmPaste(args string) error {
+	if sm.pendingPaste == nil {
+		return errors.New("No paste waiting to be sent!")
+	}
+	lines := sm.pendingPaste
+	sm.pendingPaste = nil
+	switch strings.TrimSpace(args) {
+	case "":
+		for _, line := range lines {
+			sm.handleInputLine(strings.TrimRight(line, "\r"))
+		}
+	case "cancel":
+		sm.info("Dropped " + strconv.Itoa(len(lines)) + " pasted lines")
+	default:
+		sm.pendingPaste = lines
+		return errors.New("Usage: /paste [cancel]")
+	}
+	return nil
+}
+
+// `/queue` lists lines waiting to be sent to the current server,
+// `/queue cancel [n]` drops one of them or all of them
+func (sm *ServerManager) outputQueue(args string) error {
+	strs := strings.Fields(args)
+	if len(strs) > 0 {
+		if strs[0] != "cancel" || len(strs) > 2 {
+			return errors.New("Usage: /queue [cancel [<number>]]")
+		}
+		idx := -1
+		if len(strs) == 2 {
+			n, err := strconv.Atoi(strs[1])
+			if err != nil || n < 1 {
+				return errors.New("`" + strs[1] + "` isn't a line number from /queue!")
+			}
+			idx = n - 1
+		}
+		dropped := sm.current.CancelPending(idx)
+		if dropped == 0 {
+			return errors.New("Nothing to cancel!")
+		}
+		sm.info("Cancelled " + strconv.Itoa(dropped) + " queued line(s)")
+		return nil
+	}
+	pending := sm.current.Pending()
+	if len(pending) == 0 {
+		sm.output(RoleInfo.Text("Nothing waiting to be sent to "), RoleServer.Text(sm.current.Addr))
+		return nil
+	}
+	sm.output(RoleInfo.Text("Waiting to be sent to "), RoleServer.Text(sm.current.Addr))
+	for idx, line := range pending {
+		sm.output(RoleItem.Text("  "+strconv.Itoa(idx+1)+" "), RoleText.Text(redact(line)))
+	}
+	return nil
+}
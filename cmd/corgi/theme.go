@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// what a piece of text is, so the theme can decide how it looks
+type Role string
+
+const (
+	RoleNone      Role = ""
+	RoleText      Role = "text" // what people say
+	RoleTimestamp Role = "timestamp"
+	RoleOwnNick   Role = "own_nick"
+	RoleNick      Role = "nick" // everyone else's
+	RoleHighlight Role = "highlight"
+	RoleJoinPart  Role = "join_part" // joins, parts, quits, kicks and nick changes
+	RoleAway      Role = "away"      // nicks of users who are away
+	RoleChannel   Role = "channel"
+	RolePrivate   Role = "private"
+	RoleServer    Role = "server"
+	RoleItem      Role = "item" // names in lists, like aliases and ignores
+	RoleInfo      Role = "info"
+	RoleNote      Role = "note"
+	RoleSuccess   Role = "success"
+	RoleWarning   Role = "warning"
+	RoleError     Role = "error"
+	RolePrompt    Role = "prompt"
+	RoleStatus    Role = "status"
+)
+
+// a segment of text that's drawn however the theme says role should be
+func (role Role) Text(text string) Segment {
+	return Segment{Text: text, Role: role}
+}
+
+// how a role is drawn
+type Style struct {
+	Hue        Hue
+	Background Hue
+	Attrs      Attr
+}
+
+// styles by role. Roles a theme leaves out look as they do in the default.
+type Theme map[Role]Style
+
+var hueNames = map[string]Hue{
+	"default": HueDefault, "black": HueBlack, "red": HueRed, "green": HueGreen,
+	"yellow": HueYellow, "blue": HueBlue, "magenta": HueMagenta, "cyan": HueCyan,
+	"light-gray": HueLightGray, "dark-gray": HueDarkGray, "light-red": HueLightRed,
+	"light-green": HueLightGreen, "light-yellow": HueLightYellow, "light-blue": HueLightBlue,
+	"light-magenta": HueLightMagenta, "light-cyan": HueLightCyan, "white": HueWhite}
+
+var attrNames = map[string]Attr{
+	"bold": AttrBold, "italic": AttrItalic, "underline": AttrUnderline,
+	"reverse": AttrReverse, "strike": AttrStrike}
+
+// parses a style like "bold light-magenta on black": any attributes, then
+// the color, then optionally "on" and the background
+func ParseStyle(str string) (Style, error) {
+	var style Style
+	words := strings.Fields(strings.ToLower(str))
+	for len(words) > 0 {
+		if attr, ok := attrNames[words[0]]; ok {
+			style.Attrs |= attr
+			words = words[1:]
+		} else {
+			break
+		}
+	}
+	if len(words) > 0 && words[0] != "on" {
+		hue, ok := hueNames[words[0]]
+		if !ok {
+			return style, errors.New("Unknown color " + words[0] + " in style `" + str + "`!")
+		}
+		style.Hue = hue
+		words = words[1:]
+	}
+	if len(words) == 2 && words[0] == "on" {
+		hue, ok := hueNames[words[1]]
+		if !ok {
+			return style, errors.New("Unknown color " + words[1] + " in style `" + str + "`!")
+		}
+		style.Background = hue
+	} else if len(words) > 0 {
+		return style, errors.New("Can't understand style `" + str + "`!")
+	}
+	return style, nil
+}
+
+// the themes corgi comes with
+var bundledThemes = map[string]Theme{
+	"default": {
+		RoleTimestamp: {Hue: HueDarkGray},
+		RoleOwnNick:   {Hue: HueLightMagenta},
+		RoleNick:      {Hue: HueMagenta},
+		RoleHighlight: {Hue: HueYellow, Attrs: AttrBold},
+		RoleJoinPart:  {Hue: HueDarkGray},
+		RoleAway:      {Hue: HueDarkGray},
+		RoleChannel:   {Hue: HueYellow},
+		RolePrivate:   {Hue: HueBlue},
+		RoleServer:    {Hue: HueMagenta},
+		RoleItem:      {Hue: HueYellow},
+		RoleInfo:      {Hue: HueBlue},
+		RoleNote:      {Hue: HueDarkGray},
+		RoleSuccess:   {Hue: HueGreen},
+		RoleWarning:   {Hue: HueYellow},
+		RoleError:     {Hue: HueRed},
+		RolePrompt:    {Hue: HueBlue},
+		RoleStatus:    {Hue: HueMagenta}},
+	// for terminals with a light background, where yellow and gray are hard
+	// to read
+	"light": {
+		RoleTimestamp: {Hue: HueDarkGray},
+		RoleOwnNick:   {Hue: HueMagenta, Attrs: AttrBold},
+		RoleNick:      {Hue: HueBlue},
+		RoleHighlight: {Hue: HueRed, Attrs: AttrBold},
+		RoleJoinPart:  {Hue: HueDarkGray},
+		RoleAway:      {Hue: HueLightGray},
+		RoleChannel:   {Hue: HueCyan},
+		RolePrivate:   {Hue: HueMagenta},
+		RoleServer:    {Hue: HueBlue},
+		RoleItem:      {Hue: HueCyan},
+		RoleInfo:      {Hue: HueBlue},
+		RoleNote:      {Hue: HueDarkGray},
+		RoleSuccess:   {Hue: HueGreen},
+		RoleWarning:   {Hue: HueMagenta},
+		RoleError:     {Hue: HueRed, Attrs: AttrBold},
+		RolePrompt:    {Hue: HueBlue},
+		RoleStatus:    {Hue: HueWhite, Background: HueBlue}},
+	// no colors at all, only attributes
+	"mono": {
+		RoleTimestamp: {},
+		RoleOwnNick:   {Attrs: AttrBold},
+		RoleNick:      {Attrs: AttrBold},
+		RoleHighlight: {Attrs: AttrReverse},
+		RoleJoinPart:  {Attrs: AttrItalic},
+		RoleAway:      {Attrs: AttrItalic},
+		RoleChannel:   {Attrs: AttrUnderline},
+		RolePrivate:   {Attrs: AttrItalic},
+		RoleServer:    {Attrs: AttrUnderline},
+		RoleItem:      {Attrs: AttrBold},
+		RoleInfo:      {},
+		RoleNote:      {Attrs: AttrItalic},
+		RoleSuccess:   {},
+		RoleWarning:   {Attrs: AttrBold},
+		RoleError:     {Attrs: AttrBold | AttrReverse},
+		RolePrompt:    {Attrs: AttrBold},
+		RoleStatus:    {Attrs: AttrReverse}},
+}
+
+// the directory user themes are loaded from, one JSON file per theme
+func themeDir() string {
+	return configPath("themes")
+}
+
+// loads a theme by name, from the theme directory or else the bundled
+// ones. Theme files map role names to styles, e.g.
+//
+//	{"own_nick": "bold light-magenta", "status": "white on blue"}
+func LoadTheme(name string) (Theme, error) {
+	data, err := os.ReadFile(filepath.Join(themeDir(), name+".json"))
+	if os.IsNotExist(err) {
+		if theme, ok := bundledThemes[name]; ok {
+			return theme, nil
+		}
+		return nil, errors.New("No theme named " + name + "!")
+	} else if err != nil {
+		return nil, err
+	}
+	var styles map[string]string
+	if err := json.Unmarshal(data, &styles); err != nil {
+		return nil, errors.New("Failed to read theme " + name + "! Error is: " + err.Error())
+	}
+	theme := make(Theme)
+	for role, str := range styles {
+		style, err := ParseStyle(str)
+		if err != nil {
+			return nil, errors.New("Failed to read theme " + name + "! " + err.Error())
+		}
+		theme[Role(role)] = style
+	}
+	return theme, nil
+}
+
+// the names of every theme there is to choose from
+func themeNames() []string {
+	seen := make(map[string]bool)
+	for name := range bundledThemes {
+		seen[name] = true
+	}
+	paths, _ := filepath.Glob(filepath.Join(themeDir(), "*.json"))
+	for _, path := range paths {
+		seen[strings.TrimSuffix(filepath.Base(path), ".json")] = true
+	}
+	var names []string
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// styles segments by their roles. Colors and attributes a segment already
+// has, like ones from mIRC formatting, are kept.
+func (theme Theme) apply(segments []Segment) []Segment {
+	styled := make([]Segment, len(segments))
+	for idx, segment := range segments {
+		if segment.Role != RoleNone {
+			style, ok := theme[segment.Role]
+			if !ok {
+				style = bundledThemes["default"][segment.Role]
+			}
+			if segment.Hue == HueDefault {
+				segment.Hue = style.Hue
+			}
+			if segment.Background == HueDefault {
+				segment.Background = style.Background
+			}
+			segment.Attrs |= style.Attrs
+		}
+		styled[idx] = segment
+	}
+	return styled
+}
+
+// /theme <name> switches theme and redraws, /theme lists them
+func (sm *ServerManager) setTheme(args string) error {
+	name := strings.TrimSpace(args)
+	if name == "" {
+		sm.info("All themes:")
+		for _, name := range themeNames() {
+			if name == sm.config.Theme {
+				sm.output(RoleItem.Text("  "+name), RoleSuccess.Text(" [active]"))
+			} else {
+				sm.output(RoleItem.Text("  " + name))
+			}
+		}
+		return nil
+	}
+	theme, err := LoadTheme(name)
+	if err != nil {
+		return err
+	}
+	sm.theme = theme
+	sm.config.Theme = name
+	sm.loadNickColors()
+	sm.redraw()
+	sm.info("Switched to theme " + name)
+	return sm.config.Save()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseStyle(t *testing.T) {
+	tests := []struct {
+		str  string
+		want Style
+	}{
+		{"", Style{}},
+		{"red", Style{Hue: HueRed}},
+		{"bold underline light-magenta", Style{Hue: HueLightMagenta, Attrs: AttrBold | AttrUnderline}},
+		{"White on Blue", Style{Hue: HueWhite, Background: HueBlue}},
+		{"reverse on black", Style{Background: HueBlack, Attrs: AttrReverse}},
+	}
+	for _, test := range tests {
+		if got, err := ParseStyle(test.str); err != nil || got != test.want {
+			t.Errorf("ParseStyle(%q) = %+v, %v, want %+v", test.str, got, err, test.want)
+		}
+	}
+	for _, str := range []string{"purple", "red on", "red blue", "bold on mauve"} {
+		if _, err := ParseStyle(str); err == nil {
+			t.Errorf("ParseStyle(%q) should fail", str)
+		}
+	}
+}
+
+func TestThemeFile(t *testing.T) {
+	sm, _ := newTestManager(t)
+	if err := os.MkdirAll(themeDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"error": "bold white on red"}`
+	if err := os.WriteFile(filepath.Join(themeDir(), "loud.json"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var got []Segment
+	sm.wait(func() {
+		sm.processCommand("theme", "loud")
+		got = sm.theme.apply([]Segment{RoleError.Text("oops"), RoleInfo.Text("fyi"), {Text: "mirc", Hue: HueGreen, Role: RoleError}})
+	})
+	want := []Segment{
+		{Text: "oops", Hue: HueWhite, Background: HueRed, Attrs: AttrBold, Role: RoleError},
+		// left out of the theme, so as in the default
+		{Text: "fyi", Hue: HueBlue, Role: RoleInfo},
+		{Text: "mirc", Hue: HueGreen, Background: HueRed, Attrs: AttrBold, Role: RoleError},
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Errorf("segment %d is %+v, want %+v", idx, got[idx], want[idx])
+		}
+	}
+	if sm.config.Theme != "loud" {
+		t.Errorf("config theme is %q, want loud", sm.config.Theme)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+)
+
+// a front-end for corgi: PaneUi, LineUi and HeadlessUi. ServerManager only
+// calls it from the event loop, apart from Input which has a goroutine of its
+// own reading from it.
+type Ui interface {
+	// every line the user enters, closed once they're done with the UI
+	Input() <-chan string
+	// adds a line to the output
+	Print(segments ...Segment)
+	// empties the output, e.g. before showing another channel
+	Clear()
+	SetPrompt(segments ...Segment)
+	// a line summing up where we are, like the current server and its lag
+	SetStatus(segments ...Segment)
+	// which buffer is being typed into, for per-buffer input history
+	SetBuffer(name string)
+	// sends the terminal a sequence that draws nothing, like a bell or a
+	// desktop notification, for UIs on a terminal
+	Alert(sequence string)
+	// must be called on program exit to clean up after the UI
+	Close()
+}
+
+// a Ui that can edit the input line itself, with history browsing, completion
+// and the formatting keys. Only LineUi can, and only on a terminal that isn't
+// dumb; GoPanes edits its input line without letting us see the keys.
+type editingUi interface {
+	Editing() bool
+	// how to complete the input line
+	SetCompleter(completer *Completer)
+}
+
+// whether the Ui is editing the input line, so history, completion and the
+// formatting keys work
+func (sm *ServerManager) editsInput() bool {
+	ui, ok := sm.ui.(editingUi)
+	return ok && ui.Editing()
+}
+
+// the 16 color terminal palette, plus whatever the terminal's default is
+type Hue int
+
+const (
+	HueDefault Hue = iota
+	HueBlack
+	HueRed
+	HueGreen
+	HueYellow
+	HueBlue
+	HueMagenta
+	HueCyan
+	HueLightGray
+	HueDarkGray
+	HueLightRed
+	HueLightGreen
+	HueLightYellow
+	HueLightBlue
+	HueLightMagenta
+	HueLightCyan
+	HueWhite
+)
+
+// text attributes, combined with |
+type Attr int
+
+const (
+	AttrBold Attr = 1 << iota
+	AttrItalic
+	AttrUnderline
+	AttrReverse
+	AttrStrike
+)
+
+// a run of text drawn in one style. UIs draw as much of the style as they
+// can and ignore the rest.
+type Segment struct {
+	Text       string
+	Hue        Hue
+	Background Hue // HueDefault leaves the terminal's own
+	Attrs      Attr
+	// set for text the theme styles, see Theme.apply
+	Role Role
+}
+
+// the text of a line without any colors
+func plainText(segments []Segment) string {
+	text := ""
+	for _, segment := range segments {
+		text += segment.Text
+	}
+	return text
+}
+
+// text without control characters, e.g. from a server, so it can't move the
+// cursor, retitle the window or end one of our escape sequences early and
+// have the terminal run whatever comes after. Formatting codes are parsed out
+// before this, so anything left over is stray.
+func stripControls(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r >= 0x7f && r < 0xa0 {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func (sm *ServerManager) output(segments ...Segment) {
+	sm.ui.Print(sm.theme.apply(segments)...)
+}
+
+// semantic sytax coloring
+func (sm *ServerManager) info(line string) {
+	sm.output(RoleInfo.Text(line))
+}
+
+func (sm *ServerManager) err(line string) {
+	sm.output(RoleError.Text(line))
+}
+
+func (sm *ServerManager) warn(line string) {
+	sm.output(RoleWarning.Text(line))
+}
+
+func (sm *ServerManager) success(line string) {
+	sm.output(RoleSuccess.Text(line))
+}
+
+func (sm *ServerManager) note(line string) {
+	sm.output(RoleNote.Text(line))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// a front-end for running corgi as a daemon, e.g. to host bot scripts. There's
+// no input beyond the commands given on the command line, and output is
+// logged as plain text with timestamps.
+type HeadlessUi struct {
+	out   io.Writer
+	input chan string
+}
+
+func NewHeadlessUi(out io.Writer) *HeadlessUi {
+	// input is never closed, so corgi runs until it's told to quit
+	return &HeadlessUi{out: out, input: make(chan string)}
+}
+
+func (ui *HeadlessUi) Input() <-chan string {
+	return ui.input
+}
+
+func (ui *HeadlessUi) Print(segments ...Segment) {
+	fmt.Fprintln(ui.out, time.Now().Format("2006-01-02 15:04:05")+" "+stripControls(plainText(segments)))
+}
+
+// nothing to draw, the log keeps everything
+func (ui *HeadlessUi) Clear()                        {}
+func (ui *HeadlessUi) SetPrompt(segments ...Segment) {}
+func (ui *HeadlessUi) SetStatus(segments ...Segment) {}
+func (ui *HeadlessUi) SetBuffer(name string)         {}
+func (ui *HeadlessUi) Alert(sequence string)         {}
+func (ui *HeadlessUi) Close()                        {}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// a plain line-mode front-end for dumb terminals and screen readers: output
+// is printed as it comes, with ANSI colors unless NO_COLOR is set. On a
+// terminal that isn't dumb, input is edited here a key at a time, with
+// history and completion, and the terminal marks pastes so one of several
+// lines is entered as a whole; otherwise it's read a line at a time.
+type LineUi struct {
+	// output comes from the event loop and echoed input from the input
+	// goroutine, so both hold mu
+	mu        sync.Mutex
+	out       io.Writer
+	color     bool
+	prompt    []Segment
+	status    []Segment
+	input     chan string
+	editor    *lineEditor // nil when the terminal edits lines itself
+	completer *Completer
+	restore   func() // puts the terminal back how we found it
+}
+
+func NewLineUi(in io.Reader, out io.Writer) *LineUi {
+	_, noColor := os.LookupEnv("NO_COLOR")
+	ui := &LineUi{
+		out:   out,
+		color: !noColor,
+		input: make(chan string)}
+	if f, ok := in.(*os.File); ok && os.Getenv("TERM") != "dumb" {
+		if restore, err := rawTerminal(f); err == nil {
+			ui.editor = &lineEditor{history: NewInputHistory(configPath("history.json"))}
+			// turns on bracketed paste
+			fmt.Fprint(out, "\x1b[?2004h")
+			ui.restore = func() {
+				fmt.Fprint(out, "\x1b[?2004l")
+				restore()
+			}
+			go ui.editInput(in)
+			return ui
+		}
+	}
+	go ui.readInput(in)
+	return ui
+}
+
+func (ui *LineUi) readInput(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		ui.input <- scanner.Text()
+	}
+	close(ui.input)
+}
+
+// reads keys and edits the input line with them, sending it on Enter
+func (ui *LineUi) editInput(in io.Reader) {
+	reader := bufio.NewReader(in)
+	for {
+		key, err := readKey(reader)
+		if err != nil {
+			break
+		}
+		if key == "Tab" {
+			ui.complete()
+			continue
+		}
+		var text string
+		if key == "Paste" {
+			// read before locking, since the rest of it may take a while
+			if text, err = readPaste(reader); err != nil {
+				break
+			}
+		}
+		ui.mu.Lock()
+		var line string
+		var done bool
+		if key == "Paste" {
+			line, done = ui.editor.paste(text)
+		} else {
+			line, done = ui.editor.handleKey(key)
+		}
+		if done {
+			// leave what was typed on screen, as the terminal would have
+			fmt.Fprint(ui.out, "\r\n")
+		}
+		ui.drawPrompt()
+		ui.mu.Unlock()
+		if done {
+			ui.input <- line
+		}
+	}
+	close(ui.input)
+}
+
+// completes the input line. Finding completions waits on the event loop,
+// which may be waiting to print, so mu isn't held meanwhile.
+func (ui *LineUi) complete() {
+	ui.mu.Lock()
+	line, completer := ui.editor.String(), ui.completer
+	ui.mu.Unlock()
+	if completer == nil {
+		return
+	}
+	completed := completer.Complete(line)
+	ui.mu.Lock()
+	ui.editor.setLine(completed)
+	ui.drawPrompt()
+	ui.mu.Unlock()
+}
+
+func (ui *LineUi) Input() <-chan string {
+	return ui.input
+}
+
+// ANSI SGR color codes for each hue
+var ansiCodes = map[Hue]int{
+	HueBlack: 30, HueRed: 31, HueGreen: 32, HueYellow: 33,
+	HueBlue: 34, HueMagenta: 35, HueCyan: 36, HueLightGray: 37,
+	HueDarkGray: 90, HueLightRed: 91, HueLightGreen: 92, HueLightYellow: 93,
+	HueLightBlue: 94, HueLightMagenta: 95, HueLightCyan: 96, HueWhite: 97}
+
+// ANSI SGR codes for each attribute
+var ansiAttrCodes = map[Attr]int{
+	AttrBold: 1, AttrItalic: 3, AttrUnderline: 4, AttrReverse: 7, AttrStrike: 9}
+
+// the SGR parameters for a segment's style, empty for the default style
+func ansiStyle(segment Segment) []string {
+	var codes []string
+	if code, ok := ansiCodes[segment.Hue]; ok {
+		codes = append(codes, strconv.Itoa(code))
+	}
+	// background codes are 10 past the foreground ones
+	if code, ok := ansiCodes[segment.Background]; ok {
+		codes = append(codes, strconv.Itoa(code+10))
+	}
+	for attr := AttrBold; attr <= AttrStrike; attr <<= 1 {
+		if segment.Attrs&attr != 0 {
+			codes = append(codes, strconv.Itoa(ansiAttrCodes[attr]))
+		}
+	}
+	return codes
+}
+
+func (ui *LineUi) render(segments []Segment) string {
+	if !ui.color {
+		return stripControls(plainText(segments))
+	}
+	line := ""
+	for _, segment := range segments {
+		if codes := ansiStyle(segment); len(codes) > 0 {
+			line += "\x1b[" + strings.Join(codes, ";") + "m" + stripControls(segment.Text) + "\x1b[0m"
+		} else {
+			line += stripControls(segment.Text)
+		}
+	}
+	return line
+}
+
+// redraws the status, prompt and anything being typed at the start of the
+// current line. Callers hold mu.
+func (ui *LineUi) drawPrompt() {
+	fmt.Fprint(ui.out, "\r\x1b[K")
+	if len(ui.status) > 0 {
+		fmt.Fprint(ui.out, ui.render(ui.status)+" ")
+	}
+	fmt.Fprint(ui.out, ui.render(ui.prompt))
+	if ui.editor != nil {
+		fmt.Fprint(ui.out, ui.editor.display())
+		// put the cursor back where it's editing
+		if back := len(ui.editor.line) - ui.editor.cursor; back > 0 {
+			fmt.Fprint(ui.out, "\x1b["+strconv.Itoa(back)+"D")
+		}
+	}
+}
+
+func (ui *LineUi) Print(segments ...Segment) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	fmt.Fprint(ui.out, "\r\x1b[K"+ui.render(segments)+"\n")
+	ui.drawPrompt()
+}
+
+// there's no screen to clear, so just leave a gap
+func (ui *LineUi) Clear() {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	fmt.Fprint(ui.out, "\r\x1b[K\n")
+	ui.drawPrompt()
+}
+
+func (ui *LineUi) SetPrompt(segments ...Segment) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	ui.prompt = segments
+	ui.drawPrompt()
+}
+
+func (ui *LineUi) SetStatus(segments ...Segment) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	ui.status = segments
+	ui.drawPrompt()
+}
+
+// history and completion only work when we're editing the line ourselves
+func (ui *LineUi) SetBuffer(name string) {
+	if ui.editor != nil {
+		ui.editor.history.SwitchBuffer(name)
+	}
+}
+
+// whether we're editing the input line, rather than the terminal
+func (ui *LineUi) Editing() bool {
+	return ui.editor != nil
+}
+
+func (ui *LineUi) SetCompleter(completer *Completer) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	ui.completer = completer
+}
+
+func (ui *LineUi) Alert(sequence string) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	fmt.Fprint(ui.out, sequence)
+}
+
+func (ui *LineUi) Close() {
+	fmt.Fprintln(ui.out)
+	if ui.restore != nil {
+		ui.restore()
+	}
+	if ui.editor != nil {
+		if err := ui.editor.history.Save(); err != nil {
+			fmt.Fprintln(ui.out, "Failed to save input history: "+err.Error())
+		}
+	}
+}
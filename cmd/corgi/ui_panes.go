@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	gp "github.com/natemealey/GoPanes"
+	"os"
+)
+
+// the full screen front-end: output, a status line and an input line, each
+// in a GoPanes pane. GoPanes edits the input line itself without letting us
+// see the keys, so it isn't an editingUi: browsing history, completion and the
+// formatting keys are only in LineUi. What's typed here is still added to the
+// shared history.
+type PaneUi struct {
+	panes     *gp.GoPaneUi
+	inputBox  *gp.GoPane
+	outputBox *gp.GoPane
+	statusBox *gp.GoPane // nil if the screen couldn't fit it
+	history   *InputHistory
+	input     chan string
+}
+
+func NewPaneUi() *PaneUi {
+	panes := gp.NewGoPaneUi()
+	if panes.Root.Horiz(-2) {
+		panes.Root.Second.MakeEditable()
+		panes.FocusPane(panes.Root.Second)
+		newUi := PaneUi{
+			panes:     panes,
+			inputBox:  panes.Root.Second,
+			outputBox: panes.Root.First,
+			history:   NewInputHistory(configPath("history.json")),
+			input:     make(chan string)}
+		// the status line sits between the output and the input
+		if panes.Root.First.Horiz(-1) {
+			newUi.outputBox = panes.Root.First.First
+			newUi.statusBox = panes.Root.First.Second
+		}
+		newUi.render()
+		go newUi.readInput()
+		return &newUi
+	}
+	fmt.Println("Failed to split")
+	return nil
+}
+
+func (ui *PaneUi) Close() {
+	ui.panes.Close()
+	if err := ui.history.Save(); err != nil {
+		fmt.Println("Failed to save input history: " + err.Error())
+	}
+}
+
+func (ui *PaneUi) readInput() {
+	for ui.inputBox.IsAlive() {
+		line := ui.inputBox.GetLine()
+		ui.history.Add(line)
+		ui.input <- line
+	}
+	close(ui.input)
+}
+
+func (ui *PaneUi) Input() <-chan string {
+	return ui.input
+}
+
+func (ui *PaneUi) SetBuffer(name string) {
+	ui.history.SwitchBuffer(name)
+}
+
+// GoPanes has no way to send these, so they go straight to the terminal in
+// one write from the event loop, which is what draws the panes. Neither a
+// bell nor an OSC moves the cursor, so the screen is left as GoPanes drew it.
+func (ui *PaneUi) Alert(sequence string) {
+	os.Stdout.WriteString(sequence)
+}
+
+func (ui *PaneUi) render() {
+	ui.panes.Root.Refresh()
+}
+
+func (ui *PaneUi) SetPrompt(segments ...Segment) {
+	ui.inputBox.ChangePrompt(toColorStrs(segments))
+}
+
+func (ui *PaneUi) SetStatus(segments ...Segment) {
+	if ui.statusBox != nil {
+		ui.statusBox.Clear()
+		ui.statusBox.AddLine(toColorStrs(segments))
+		ui.statusBox.Refresh()
+	}
+}
+
+func (ui *PaneUi) Clear() {
+	ui.outputBox.Clear()
+	ui.outputBox.Refresh()
+}
+
+func (ui *PaneUi) Print(segments ...Segment) {
+	ui.outputBox.AddLine(toColorStrs(segments))
+	ui.outputBox.Refresh()
+}
+
+// GoPanes only has a handful of colors, so the rest of the palette is drawn
+// with the nearest one, and backgrounds and attributes are left out
+func toColorStrs(segments []Segment) []gp.ColorStr {
+	colorStrs := make([]gp.ColorStr, len(segments))
+	for idx, segment := range segments {
+		text := stripControls(segment.Text)
+		switch segment.Hue {
+		case HueRed, HueLightRed:
+			colorStrs[idx] = gp.Color.Red(text)
+		case HueGreen, HueLightGreen:
+			colorStrs[idx] = gp.Color.Green(text)
+		case HueYellow, HueLightYellow:
+			colorStrs[idx] = gp.Color.Yellow(text)
+		case HueBlue, HueLightBlue, HueCyan, HueLightCyan:
+			colorStrs[idx] = gp.Color.Blue(text)
+		case HueMagenta, HueLightMagenta:
+			colorStrs[idx] = gp.Color.Magenta(text)
+		case HueDarkGray, HueBlack:
+			colorStrs[idx] = gp.Color.DarkGray(text)
+		default:
+			colorStrs[idx] = gp.Color.Default(text)
+		}
+	}
+	return colorStrs
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFrontEndsStripControls(t *testing.T) {
+	// clears the screen and retitles the window, with a C1 CSI for good measure
+	evil := "hi\x1b[2J\x1b]0;pwned\x07\u009b31m\r\n\x7fthere"
+	line := []Segment{RoleNick.Text("<mallory> "), {Text: evil, Hue: HueRed}}
+	want := "<mallory> hi[2J]0;pwned31mthere"
+
+	for _, color := range []bool{false, true} {
+		var out bytes.Buffer
+		ui := &LineUi{out: &out, color: color}
+		ui.Print(line...)
+		if strings.Contains(out.String(), "\x1b[2J") || strings.Contains(out.String(), "\x07") || strings.Contains(out.String(), "\u009b") {
+			t.Errorf("with color %v, printed %q", color, out.String())
+		}
+		if !color && !strings.Contains(out.String(), want) {
+			t.Errorf("printed %q, want it to contain %q", out.String(), want)
+		}
+	}
+
+	var out bytes.Buffer
+	NewHeadlessUi(&out).Print(line...)
+	if !strings.HasSuffix(out.String(), " "+want+"\n") {
+		t.Errorf("logged %q, want %q", out.String(), want)
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	var out bytes.Buffer
+	(&LineUi{out: &out}).Alert("\a")
+	if out.String() != "\a" {
+		t.Errorf("the line front-end wrote %q, want a bell", out.String())
+	}
+	out.Reset()
+	NewHeadlessUi(&out).Alert("\a")
+	if out.Len() > 0 {
+		t.Errorf("the headless front-end wrote %q to its log", out.String())
+	}
+}
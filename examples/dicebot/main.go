@@ -0,0 +1,115 @@
+// A small bot built on corgi's bot package. It rolls dice, remembers when it
+// last saw people, and answers greetings. To try it against a local server:
+//
+//	go run ./examples/dicebot -server 127.0.0.1:6667 -channels '#test' -admin 'you!*@*'
+//
+// then say `!help` in #test.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/natemealey/corgi/bot"
+	"math/rand"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	server := flag.String("server", "127.0.0.1:6667", "host:port of the IRC server")
+	nick := flag.String("nick", "dicebot", "nick to use")
+	channels := flag.String("channels", "#test", "comma separated channels to join")
+	admin := flag.String("admin", "", "hostmask allowed to use !quit, e.g. you!*@*")
+	account := flag.String("account", "", "services account allowed to use !quit")
+	flag.Parse()
+
+	b := bot.New(*server, *nick, strings.Split(*channels, ",")...)
+
+	b.Command("roll", "rolls dice, e.g. !roll 2d6", func(ctx *bot.Context) {
+		spec := "1d6"
+		if len(ctx.Args) > 0 {
+			spec = ctx.Args[0]
+		}
+		count, sides, ok := parseDice(spec)
+		if !ok {
+			ctx.Reply("usage: !roll <count>d<sides>, e.g. 2d6")
+			return
+		}
+		var rolls []string
+		total := 0
+		for i := 0; i < count; i++ {
+			roll := rand.Intn(sides) + 1
+			total += roll
+			rolls = append(rolls, strconv.Itoa(roll))
+		}
+		ctx.Reply(strings.Join(rolls, " + ") + " = " + strconv.Itoa(total))
+	})
+
+	// remember who spoke when, per channel
+	b.Match(".", func(ctx *bot.Context) {
+		ctx.State()[strings.ToLower(ctx.Nick())] = time.Now()
+	})
+	b.Command("seen", "says when someone last spoke here, e.g. !seen alice", func(ctx *bot.Context) {
+		if len(ctx.Args) != 1 {
+			ctx.Reply("usage: !seen <nick>")
+			return
+		}
+		if seen, ok := ctx.State()[strings.ToLower(ctx.Args[0])].(time.Time); ok {
+			ctx.Reply(ctx.Args[0] + " last spoke " + time.Since(seen).Round(time.Second).String() + " ago")
+		} else {
+			ctx.Reply("I haven't seen " + ctx.Args[0] + " say anything here")
+		}
+	})
+
+	b.Match(`(?i)^(hi|hello|hey)[,:]? `+regexp.QuoteMeta(*nick)+`\b`, func(ctx *bot.Context) {
+		ctx.Bot.Say(ctx.ReplyTo, ctx.Matches[1]+" "+ctx.Nick()+"!")
+	})
+
+	quit := b.Command("quit", "makes the bot leave", func(ctx *bot.Context) {
+		ctx.Bot.Quit("asked to leave by " + ctx.Nick())
+	})
+	if *admin != "" {
+		quit.Hostmasks = []string{*admin}
+	}
+	if *account != "" {
+		quit.Accounts = []string{*account}
+	}
+	if len(quit.Hostmasks) == 0 && len(quit.Accounts) == 0 {
+		// nobody may use it rather than everybody
+		quit.Hostmasks = []string{"nobody!nobody@nowhere.invalid"}
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		b.Quit("shutting down")
+	}()
+
+	if err := b.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// parses dice like 2d6, keeping the numbers small enough to be sensible
+func parseDice(spec string) (count, sides int, ok bool) {
+	strs := strings.SplitN(strings.ToLower(spec), "d", 2)
+	if len(strs) != 2 {
+		return 0, 0, false
+	}
+	count, err := strconv.Atoi(strs[0])
+	if err != nil || count < 1 || count > 20 {
+		return 0, 0, false
+	}
+	sides, err = strconv.Atoi(strs[1])
+	if err != nil || sides < 2 || sides > 1000 {
+		return 0, 0, false
+	}
+	return count, sides, true
+}
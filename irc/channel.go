@@ -0,0 +1,61 @@
+package irc
+
+import (
+	"sort"
+	"time"
+)
+
+// a channel we're on and who else is there. All times are in local time.
+type Channel struct {
+	Name       string
+	Key        string          // remembered for rejoining keyed (+k) channels
+	Nicks      map[string]bool // acts as a set
+	LastSpoke  map[string]time.Time
+	InitTime   time.Time
+	UpdateTime time.Time
+}
+
+func NewChannel(name string) *Channel {
+	return &Channel{
+		Name:       name,
+		InitTime:   time.Now(),
+		UpdateTime: time.Now(),
+		Nicks:      make(map[string]bool),
+		LastSpoke:  make(map[string]time.Time)}
+}
+
+// nicks in the channel in alphabetical order
+func (channel *Channel) SortedNicks() []string {
+	nicks := make([]string, 0, len(channel.Nicks))
+	for nick := range channel.Nicks {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+	return nicks
+}
+
+// nicks in the channel, most recently active first then alphabetically
+func (channel *Channel) RecentNicks() []string {
+	nicks := channel.SortedNicks()
+	sort.SliceStable(nicks, func(i, j int) bool {
+		return channel.LastSpoke[nicks[i]].After(channel.LastSpoke[nicks[j]])
+	})
+	return nicks
+}
+
+func (channel *Channel) addNick(nick string) {
+	channel.Nicks[nick] = true
+}
+
+func (channel *Channel) removeNick(nick string) {
+	delete(channel.Nicks, nick)
+	delete(channel.LastSpoke, nick)
+}
+
+func (channel *Channel) renameNick(oldNick, newNick string) {
+	channel.Nicks[newNick] = true
+	if spoke, ok := channel.LastSpoke[oldNick]; ok {
+		channel.LastSpoke[newNick] = spoke
+	}
+	channel.removeNick(oldNick)
+}
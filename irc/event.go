@@ -0,0 +1,63 @@
+package irc
+
+import (
+	"time"
+)
+
+// commands for events that aren't lines from the server, which handlers can
+// be registered for like any other command
+const (
+	// we've dialled the server and sent NICK and USER
+	Connected = "CONNECTED"
+	// the server welcomed us. Comes before we rejoin our channels, so
+	// handlers can e.g. identify to services first.
+	Registered = "REGISTERED"
+	// the connection closed, with Event.Err saying why unless we hung up
+	Disconnected = "DISCONNECTED"
+	// we'll try to connect again after Event.Delay. Event.Err is why the last
+	// attempt failed, if there was one.
+	Reconnecting = "RECONNECTING"
+)
+
+// registers for every command, e.g. to log everything
+const AnyCommand = "*"
+
+// something that happened on a server. By the time handlers see an event the
+// session state has already been updated, so e.g. after a PART the channel
+// is no longer in Server.Channels; Channel and Channels are how things were.
+type Event struct {
+	Message
+	Raw    string // the line as the server sent it
+	Server *Server
+	// whether we sent it, e.g. the echo of our own JOIN or NICK
+	Self bool
+	// the channel the message was about, if we're on it or just left it
+	Channel *Channel
+	// for NICK and QUIT, every channel we shared with the nick
+	Channels []*Channel
+	Err      error
+	Delay    time.Duration
+}
+
+// handles events for the commands it's registered for with Server.Handle
+type Handler func(ev *Event)
+
+// registers handler for every event with the given command, a numeric like
+// "001", one of the event constants or AnyCommand. Handlers run in the order
+// they were registered, those for AnyCommand after the rest.
+func (s *Server) Handle(command string, handler Handler) {
+	if s.handlers == nil {
+		s.handlers = make(map[string][]Handler)
+	}
+	s.handlers[command] = append(s.handlers[command], handler)
+}
+
+func (s *Server) emit(ev *Event) {
+	ev.Server = s
+	for _, handler := range s.handlers[ev.Command] {
+		handler(ev)
+	}
+	for _, handler := range s.handlers[AnyCommand] {
+		handler(ev)
+	}
+}
@@ -0,0 +1,208 @@
+// Package irctest provides a fake IRC server for testing IRC clients, in the
+// spirit of net/http/httptest.
+package irctest
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/natemealey/corgi/irc"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// how long tests wait for something to happen before failing
+const Timeout = 2 * time.Second
+
+// a scriptable IRC server on 127.0.0.1 for tests to connect a client to. By
+// default it welcomes clients once they've sent NICK and USER, echoes nick
+// changes and answers JOINs with the channel's members. Anything else is up
+// to the test.
+type Server struct {
+	t        testing.TB
+	listener net.Listener
+	conns    chan *Conn
+	mu       sync.Mutex
+	handlers map[string]func(c *Conn, msg irc.Message)
+	members  map[string][]string // channel members listed in replies to JOIN
+}
+
+// one client connected to a Server
+type Conn struct {
+	server *Server
+	conn   net.Conn
+	lines  chan string // everything the client sent, in order
+	nick   string
+	user   bool      // whether the client has sent USER
+	closed chan bool // closed once the client hangs up
+}
+
+// a Server listening on a free port until the test ends
+func NewServer(t testing.TB) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("fake server failed to listen: %v", err)
+	}
+	fs := &Server{
+		t:        t,
+		listener: listener,
+		conns:    make(chan *Conn, 10),
+		handlers: make(map[string]func(c *Conn, msg irc.Message)),
+		members:  make(map[string][]string)}
+	fs.On("NICK", func(c *Conn, msg irc.Message) {
+		if msg.Param(0) == "" {
+			return
+		}
+		registered := c.registered()
+		oldPrefix := c.Prefix()
+		c.nick = msg.Param(0)
+		if registered {
+			c.Send(":" + oldPrefix + " NICK :" + c.nick)
+		} else if c.registered() {
+			c.welcome()
+		}
+	})
+	fs.On("USER", func(c *Conn, msg irc.Message) {
+		c.user = true
+		if c.registered() {
+			c.welcome()
+		}
+	})
+	fs.On("JOIN", func(c *Conn, msg irc.Message) {
+		for _, channelName := range strings.Split(msg.Param(0), ",") {
+			c.Send(":" + c.Prefix() + " JOIN " + channelName)
+			names := append([]string{c.nick}, fs.channelMembers(channelName)...)
+			c.Send(":fake.server 353 " + c.nick + " = " + channelName + " :" + strings.Join(names, " "))
+			c.Send(":fake.server 366 " + c.nick + " " + channelName + " :End of /NAMES list.")
+		}
+	})
+	go fs.accept()
+	t.Cleanup(func() { listener.Close() })
+	return fs
+}
+
+// the host:port to connect to
+func (fs *Server) Addr() string {
+	return fs.listener.Addr().String()
+}
+
+// replaces what the server does when a client sends command
+func (fs *Server) On(command string, handler func(c *Conn, msg irc.Message)) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.handlers[command] = handler
+}
+
+// sets who else is listed as being on channelName when a client joins it
+func (fs *Server) SetMembers(channelName string, nicks ...string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.members[channelName] = nicks
+}
+
+func (fs *Server) channelMembers(channelName string) []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.members[channelName]
+}
+
+func (fs *Server) accept() {
+	for {
+		conn, err := fs.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &Conn{
+			server: fs,
+			conn:   conn,
+			lines:  make(chan string, 100),
+			closed: make(chan bool)}
+		fs.conns <- c
+		go c.read()
+	}
+}
+
+// waits for the next client to connect
+func (fs *Server) NextConn() *Conn {
+	fs.t.Helper()
+	select {
+	case c := <-fs.conns:
+		return c
+	case <-time.After(Timeout):
+		fs.t.Fatalf("nobody connected to the fake server")
+		return nil
+	}
+}
+
+func (c *Conn) read() {
+	defer close(c.closed)
+	reader := bufio.NewReader(c.conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		msg := irc.ParseMessage(line)
+		c.server.mu.Lock()
+		handler := c.server.handlers[msg.Command]
+		c.server.mu.Unlock()
+		if handler != nil {
+			handler(c, msg)
+		}
+		c.lines <- line
+	}
+}
+
+func (c *Conn) registered() bool {
+	return c.user && c.nick != ""
+}
+
+func (c *Conn) welcome() {
+	c.Send(":fake.server 001 " + c.nick + " :Welcome to the fake network " + c.Prefix())
+}
+
+// the client's nick!user@host
+func (c *Conn) Prefix() string {
+	return c.nick + "!" + c.nick + "@localhost"
+}
+
+// sends a raw line, without its CRLF, to the client
+func (c *Conn) Send(line string) {
+	fmt.Fprint(c.conn, line+"\r\n")
+}
+
+// waits for the client to send a line starting with prefix, skipping over
+// anything else it sent first
+func (c *Conn) Expect(prefix string) string {
+	c.server.t.Helper()
+	deadline := time.After(Timeout)
+	for {
+		select {
+		case line := <-c.lines:
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		case <-deadline:
+			c.server.t.Fatalf("client never sent a line starting with %q", prefix)
+			return ""
+		}
+	}
+}
+
+// waits for the client to hang up
+func (c *Conn) ExpectClosed() {
+	c.server.t.Helper()
+	select {
+	case <-c.closed:
+	case <-time.After(Timeout):
+		c.server.t.Fatalf("client never hung up")
+	}
+}
+
+// hangs up on the client, as if the server had dropped the connection
+func (c *Conn) Close() {
+	c.conn.Close()
+}
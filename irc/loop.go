@@ -0,0 +1,70 @@
+package irc
+
+import (
+	"sync"
+)
+
+// runs functions one at a time, in the order they were posted, on whichever
+// goroutine calls Run. Posting never blocks, so functions already running on
+// the loop can post more.
+type Loop struct {
+	mu      sync.Mutex
+	queue   []func()
+	wake    chan bool
+	stopped bool
+}
+
+func NewLoop() *Loop {
+	return &Loop{wake: make(chan bool, 1)}
+}
+
+// queues fn to run on the loop
+func (loop *Loop) Post(fn func()) {
+	loop.mu.Lock()
+	loop.queue = append(loop.queue, fn)
+	loop.mu.Unlock()
+	select {
+	case loop.wake <- true:
+	default:
+	}
+}
+
+// runs posted functions until Stop is called
+func (loop *Loop) Run() {
+	for {
+		loop.mu.Lock()
+		queue, stopped := loop.queue, loop.stopped
+		loop.queue = nil
+		loop.mu.Unlock()
+		if stopped {
+			return
+		}
+		for _, fn := range queue {
+			fn()
+			if loop.Stopped() {
+				return
+			}
+		}
+		if len(queue) == 0 {
+			<-loop.wake
+		}
+	}
+}
+
+// makes Run return once the function it's running finishes. Anything still
+// queued is dropped.
+func (loop *Loop) Stop() {
+	loop.mu.Lock()
+	loop.stopped = true
+	loop.mu.Unlock()
+	select {
+	case loop.wake <- true:
+	default:
+	}
+}
+
+func (loop *Loop) Stopped() bool {
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+	return loop.stopped
+}
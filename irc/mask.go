@@ -0,0 +1,43 @@
+package irc
+
+import (
+	"strings"
+)
+
+// expands a bare nick or user@host into a full nick!user@host mask
+func NormalizeMask(mask string) string {
+	if !strings.Contains(mask, "!") && !strings.Contains(mask, "@") {
+		return mask + "!*@*"
+	} else if !strings.Contains(mask, "!") {
+		return "*!" + mask
+	}
+	return mask
+}
+
+// case insensitive glob match of a mask like *!*@example.org against a
+// nick!user@host, where * matches any run of characters and ? exactly one
+func MatchMask(mask, str string) bool {
+	mask, str = strings.ToLower(mask), strings.ToLower(str)
+	// index in mask and str to go back to after a failed match past a *
+	starMask, starStr := -1, 0
+	m, s := 0, 0
+	for s < len(str) {
+		if m < len(mask) && (mask[m] == '?' || mask[m] == str[s]) {
+			m++
+			s++
+		} else if m < len(mask) && mask[m] == '*' {
+			starMask, starStr = m, s
+			m++
+		} else if starMask >= 0 {
+			m = starMask + 1
+			starStr++
+			s = starStr
+		} else {
+			return false
+		}
+	}
+	for m < len(mask) && mask[m] == '*' {
+		m++
+	}
+	return m == len(mask)
+}
@@ -0,0 +1,44 @@
+package irc
+
+import (
+	"testing"
+)
+
+func TestNormalizeMask(t *testing.T) {
+	tests := map[string]string{
+		"alice":             "alice!*@*",
+		"*@example.org":     "*!*@example.org",
+		"alice!*@*.example": "alice!*@*.example",
+	}
+	for mask, want := range tests {
+		if got := NormalizeMask(mask); got != want {
+			t.Errorf("NormalizeMask(%q) = %q, want %q", mask, got, want)
+		}
+	}
+}
+
+func TestMatchMask(t *testing.T) {
+	tests := []struct {
+		mask, str string
+		want      bool
+	}{
+		{"alice!*@*", "alice!a@host", true},
+		{"alice!*@*", "Alice!a@host", true},
+		{"alice!*@*", "alicia!a@host", false},
+		{"alice!*@*", "bob!alice@host", false},
+		{"*!*@*.example.org", "bob!b@irc.example.org", true},
+		{"*!*@*.example.org", "bob!b@example.org", false},
+		{"al?ce!*@*", "alice!a@host", true},
+		{"al?ce!*@*", "alce!a@host", false},
+		{"*!*b*@host", "bob!xbx@host", true},
+		{"*", "", true},
+		{"", "alice!a@host", false},
+		{"a*a*a", "aaaa", true},
+		{"a*a*b", "aaaa", false},
+	}
+	for _, test := range tests {
+		if got := MatchMask(test.mask, test.str); got != test.want {
+			t.Errorf("MatchMask(%q, %q) = %v, want %v", test.mask, test.str, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package irc is the protocol and session side of corgi: it connects to an
+// IRC server, keeps track of our nick and the channels we're on, and hands
+// each line the server sends to the handlers registered for it. Anything to
+// do with showing it to a user is left to the client.
+package irc
+
+import (
+	"sort"
+	"strings"
+)
+
+// a single line of the IRC protocol
+type Message struct {
+	// IRCv3 tags, e.g. account for the sender's account when the server has
+	// the account-tag capability enabled. Valueless tags map to "".
+	Tags map[string]string
+	// who sent it, as nick!user@host or a server name. Empty for lines we send.
+	Prefix  string
+	Command string   // e.g. PRIVMSG, or a numeric reply like 001
+	Params  []string // the last one may contain spaces
+}
+
+// parses a line without its CRLF. Translated from the Twisted implementation.
+func ParseMessage(line string) Message {
+	var msg Message
+	if strings.HasPrefix(line, "@") {
+		strs := strings.SplitN(line[1:], " ", 2)
+		msg.Tags = parseTags(strs[0])
+		line = ""
+		if len(strs) > 1 {
+			line = strings.TrimLeft(strs[1], " ")
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		strs := strings.SplitN(line[1:], " ", 2)
+		msg.Prefix = strs[0]
+		line = ""
+		if len(strs) > 1 {
+			line = strs[1]
+		}
+	}
+	var params []string
+	if idx := strings.Index(line, " :"); idx >= 0 {
+		params = append(strings.Fields(line[:idx]), line[idx+2:])
+	} else {
+		params = strings.Fields(line)
+	}
+	if len(params) > 0 {
+		msg.Command, msg.Params = strings.ToUpper(params[0]), params[1:]
+	}
+	return msg
+}
+
+// the line as it's sent over the wire, without its CRLF. The last parameter
+// is sent as a trailing one whenever it needs to be.
+func (msg Message) String() string {
+	line := msg.Command
+	if msg.Prefix != "" {
+		line = ":" + msg.Prefix + " " + line
+	}
+	if len(msg.Tags) > 0 {
+		line = "@" + formatTags(msg.Tags) + " " + line
+	}
+	for idx, param := range msg.Params {
+		if idx == len(msg.Params)-1 && (param == "" || strings.HasPrefix(param, ":") || strings.Contains(param, " ")) {
+			line += " :" + param
+		} else {
+			line += " " + param
+		}
+	}
+	return line
+}
+
+// escaping for tag values, which can't contain spaces or semicolons
+var (
+	tagEscaper   = strings.NewReplacer("\\", "\\\\", ";", "\\:", " ", "\\s", "\r", "\\r", "\n", "\\n")
+	tagUnescaper = strings.NewReplacer("\\\\", "\\", "\\:", ";", "\\s", " ", "\\r", "\r", "\\n", "\n", "\\", "")
+)
+
+func parseTags(str string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(str, ";") {
+		if tag == "" {
+			continue
+		}
+		strs := strings.SplitN(tag, "=", 2)
+		if len(strs) > 1 {
+			tags[strs[0]] = tagUnescaper.Replace(strs[1])
+		} else {
+			tags[strs[0]] = ""
+		}
+	}
+	return tags
+}
+
+// tags in name order, so a message always serializes the same way
+func formatTags(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for idx, name := range names {
+		if tags[name] != "" {
+			names[idx] += "=" + tagEscaper.Replace(tags[name])
+		}
+	}
+	return strings.Join(names, ";")
+}
+
+// the idx'th parameter, or "" if there aren't that many
+func (msg Message) Param(idx int) string {
+	if idx < len(msg.Params) {
+		return msg.Params[idx]
+	}
+	return ""
+}
+
+// the text of a message like PRIVMSG, NOTICE or a numeric reply: its last
+// parameter, as long as it isn't also its first
+func (msg Message) Text() string {
+	if len(msg.Params) > 1 {
+		return msg.Params[len(msg.Params)-1]
+	}
+	return ""
+}
+
+// the nick of whoever sent the message, or the server name
+func (msg Message) Nick() string {
+	return PrefixNick(msg.Prefix)
+}
+
+// the nick part of a nick!user@host prefix
+func PrefixNick(prefix string) string {
+	return strings.TrimPrefix(strings.SplitN(prefix, "!", 2)[0], ":")
+}
+
+// whether target is a channel rather than a nick
+func IsChannel(target string) bool {
+	return target != "" && strings.ContainsRune("#&+!", rune(target[0]))
+}
@@ -0,0 +1,62 @@
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		line string
+		want Message
+	}{
+		{"PING :irc.example.org", Message{Command: "PING", Params: []string{"irc.example.org"}}},
+		{":alice!a@host PRIVMSG #go :hello there", Message{Prefix: "alice!a@host", Command: "PRIVMSG", Params: []string{"#go", "hello there"}}},
+		{":alice!a@host privmsg #go ::)", Message{Prefix: "alice!a@host", Command: "PRIVMSG", Params: []string{"#go", ":)"}}},
+		{":irc.example.org 353 corgi = #go :@alice +bob", Message{Prefix: "irc.example.org", Command: "353", Params: []string{"corgi", "=", "#go", "@alice +bob"}}},
+		{":bob!b@host NICK carol", Message{Prefix: "bob!b@host", Command: "NICK", Params: []string{"carol"}}},
+		{":bob!b@host QUIT :", Message{Prefix: "bob!b@host", Command: "QUIT", Params: []string{""}}},
+		{"@account=alice;draft/x :alice!a@host PRIVMSG #go :hi", Message{
+			Tags:   map[string]string{"account": "alice", "draft/x": ""},
+			Prefix: "alice!a@host", Command: "PRIVMSG", Params: []string{"#go", "hi"}}},
+		{`@label=a\sb\:c CAP * LS :sasl`, Message{
+			Tags:    map[string]string{"label": "a b;c"},
+			Command: "CAP", Params: []string{"*", "LS", "sasl"}}},
+		{"", Message{}},
+	}
+	for _, test := range tests {
+		if got := ParseMessage(test.line); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseMessage(%q) = %#v, want %#v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	for _, line := range []string{
+		"PING :irc.example.org",
+		":alice!a@host PRIVMSG #go :hello there",
+		":alice!a@host PRIVMSG #go ::)",
+		":bob!b@host NICK carol",
+		"QUIT :",
+		"JOIN #a,#b key",
+		`@account=alice;label=a\sb\:c :alice!a@host PRIVMSG #go :hi`,
+	} {
+		msg := ParseMessage(line)
+		if got := msg.String(); ParseMessage(got).String() != got || !reflect.DeepEqual(ParseMessage(got), msg) {
+			t.Errorf("%q doesn't survive being parsed and serialized, got %q", line, got)
+		}
+	}
+	msg := Message{Command: "PRIVMSG", Params: []string{"#go", "hi"}}
+	if got := msg.String(); got != "PRIVMSG #go hi" {
+		t.Errorf("String() = %q, want a trailing parameter only when needed", got)
+	}
+}
+
+func TestMessageNick(t *testing.T) {
+	if nick := ParseMessage(":alice!a@host PRIVMSG #go :hi").Nick(); nick != "alice" {
+		t.Errorf("Nick() = %q, want alice", nick)
+	}
+	if nick := ParseMessage(":irc.example.org 001 corgi :Welcome").Nick(); nick != "irc.example.org" {
+		t.Errorf("Nick() = %q, want the server name", nick)
+	}
+}
@@ -0,0 +1,75 @@
+package irc
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// default lag checking: PING every 30 seconds, give up after 2 minutes
+const (
+	DefaultPingInterval = 30 * time.Second
+	DefaultPingTimeout  = 2 * time.Minute
+)
+
+// sends a PING the server must answer with the same token, unless we're
+// still waiting on the last one
+func (s *Server) sendPing() {
+	if s.pingSent.IsZero() {
+		s.pingSent = time.Now()
+		s.pingToken = "corgi-" + strconv.FormatInt(s.pingSent.UnixNano(), 36)
+		s.Send("PING :" + s.pingToken)
+	}
+}
+
+// measures the lag if the PONG answers our last PING
+func (s *Server) gotPong(token string) {
+	if !s.pingSent.IsZero() && token == s.pingToken {
+		s.Lag = time.Since(s.pingSent)
+		s.pingSent = time.Time{}
+	}
+}
+
+// how long the server has left our PING unanswered
+func (s *Server) PingWait() time.Duration {
+	if s.pingSent.IsZero() {
+		return 0
+	}
+	return time.Since(s.pingSent)
+}
+
+// pings the server every PingInterval until stop is closed, treating a PING
+// left unanswered for PingTimeout as a dead connection. Runs in its own
+// goroutine and leaves the work to dispatch.
+func (s *Server) pingLoop(stop chan bool, dispatch func(fn func())) {
+	interval, timeout := s.PingInterval, s.PingTimeout
+	if interval <= 0 {
+		return
+	}
+	// check for timeouts more often than we ping, so they're noticed promptly
+	ticker := time.NewTicker(interval / 3)
+	defer ticker.Stop()
+	lastPing := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			ping := now.Sub(lastPing) >= interval
+			if ping {
+				lastPing = now
+			}
+			dispatch(func() {
+				// s.stop is replaced if we reconnect
+				if !s.Connected || s.stop != stop {
+					return
+				}
+				if timeout > 0 && s.PingWait() > timeout {
+					s.connectionLost(errors.New("no reply to PING for " + s.PingWait().Round(time.Second).String()))
+				} else if ping {
+					s.sendPing()
+				}
+			})
+		}
+	}
+}
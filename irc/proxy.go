@@ -0,0 +1,199 @@
+package irc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// why a SOCKS5 proxy refused to connect us, by its reply code
+var socksErrors = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported"}
+
+// a connection some of whose input has already been read into r
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// checks a proxy URL, socks5://[user:password@]host:port or
+// http://[user:password@]host:port, for Server.Proxy
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.New("bad proxy " + proxy + ": " + err.Error())
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, errors.New("bad proxy " + proxy + ": the scheme must be socks5 or http")
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, errors.New("bad proxy " + proxy + ": it needs a host and port")
+	}
+	return u, nil
+}
+
+// connects to addr through the proxy, which does any DNS lookups itself
+func dialProxy(dialer *net.Dialer, family, proxy, addr string) (net.Conn, error) {
+	u, err := ParseProxy(proxy)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialPreferring(dialer, family, u.Host)
+	if err != nil {
+		return nil, errors.New("proxy " + u.Host + ": " + err.Error())
+	}
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	tunnel := conn
+	if u.Scheme == "http" {
+		tunnel, err = httpConnect(conn, u, addr)
+	} else {
+		err = socksConnect(conn, u, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, errors.New("proxy " + u.Host + ": " + err.Error())
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// asks an HTTP proxy to open a tunnel to addr with CONNECT
+func httpConnect(conn net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header)}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, errors.New("bad reply to CONNECT: " + err.Error())
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("CONNECT refused: " + resp.Status)
+	}
+	// the server may have spoken already, e.g. with NOTICE AUTH
+	return bufferedConn{conn, reader}, nil
+}
+
+// asks a SOCKS5 proxy to connect to addr, as RFC 1928 and 1929 describe
+func socksConnect(conn net.Conn, u *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return errors.New("bad port " + portStr)
+	}
+	method := byte(0) // no authentication
+	if u.User != nil {
+		method = 2 // username and password
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return errors.New("bad reply to greeting: " + err.Error())
+	}
+	if reply[0] != 5 {
+		return errors.New("not a SOCKS5 proxy")
+	}
+	if reply[1] != method {
+		return errors.New("no acceptable authentication method")
+	}
+	if method == 2 {
+		password, _ := u.User.Password()
+		username := u.User.Username()
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("username or password too long")
+		}
+		auth := append([]byte{1, byte(len(username))}, username...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return errors.New("bad reply to authentication: " + err.Error())
+		}
+		if reply[1] != 0 {
+			return errors.New("authentication failed")
+		}
+	}
+
+	req := []byte{5, 1, 0} // CONNECT
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("host name too long")
+		}
+		req = append(append(req, 3, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 1), ip4...)
+	} else {
+		req = append(append(req, 4), ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	// the version, reply code, a reserved byte and the bound address's type
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return errors.New("bad reply to CONNECT: " + err.Error())
+	}
+	if header[1] != 0 {
+		reason, ok := socksErrors[header[1]]
+		if !ok {
+			reason = "error " + strconv.Itoa(int(header[1]))
+		}
+		return errors.New("CONNECT refused: " + reason)
+	}
+	// skip the bound address and port, which we've no use for
+	var length int
+	switch header[3] {
+	case 1:
+		length = net.IPv4len
+	case 4:
+		length = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(conn, reply[:1]); err != nil {
+			return errors.New("bad reply to CONNECT: " + err.Error())
+		}
+		length = int(reply[0])
+	default:
+		return errors.New("bad reply to CONNECT: unknown address type")
+	}
+	if _, err := io.ReadFull(conn, make([]byte, length+2)); err != nil {
+		return errors.New("bad reply to CONNECT: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package irc_test
+
+import (
+	"bufio"
+	"github.com/natemealey/corgi/irc"
+	"github.com/natemealey/corgi/irc/irctest"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// a proxy on a local port, handling each connection with serve
+func fakeProxy(t *testing.T, serve func(conn net.Conn)) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// dials addr and copies between it and conn until either hangs up
+func tunnel(conn net.Conn, addr string, connected func()) {
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer target.Close()
+	connected()
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+// a SOCKS5 proxy that wants the username corgi and password woof
+func socksProxy(conn net.Conn) {
+	greeting := make([]byte, 3)
+	if _, err := io.ReadFull(conn, greeting); err != nil || greeting[2] != 2 {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, 2})
+	reader := bufio.NewReader(conn)
+	readField := func() string {
+		length, _ := reader.ReadByte()
+		field := make([]byte, length)
+		io.ReadFull(reader, field)
+		return string(field)
+	}
+	reader.ReadByte() // version
+	if readField() != "corgi" || readField() != "woof" {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+	header := make([]byte, 4)
+	io.ReadFull(reader, header)
+	host := readField()
+	port := make([]byte, 2)
+	io.ReadFull(reader, port)
+	addr := net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+	tunnel(conn, addr, func() { conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0}) })
+}
+
+// an HTTP proxy that wants the username corgi and password woof
+func httpProxy(conn net.Conn) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.Method != "CONNECT" {
+		return
+	}
+	// corgi:woof in base64
+	if req.Header.Get("Proxy-Authorization") != "Basic Y29yZ2k6d29vZg==" {
+		io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return
+	}
+	tunnel(conn, req.Host, func() { io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n") })
+}
+
+func TestProxies(t *testing.T) {
+	fs := irctest.NewServer(t)
+	socks := fakeProxy(t, socksProxy)
+	httpAddr := fakeProxy(t, httpProxy)
+	// the proxy resolves the name, so use one only it could
+	_, port, _ := net.SplitHostPort(fs.Addr())
+	addr := "localhost:" + port
+
+	for _, proxy := range []string{"socks5://corgi:woof@" + socks, "http://corgi:woof@" + httpAddr} {
+		_, c, events := startServer(t, fs, func(s *irc.Server) {
+			s.Addr = addr
+			s.Proxy = proxy
+		})
+		c.Expect("USER corgi")
+		expectEvent(t, events, "001")
+	}
+
+	for proxy, want := range map[string]string{
+		"socks5://corgi:meow@" + socks: "authentication failed",
+		"socks5://" + socks:            "no acceptable authentication method",
+		"http://" + httpAddr:           "407 Proxy Authentication Required",
+		"ftp://" + httpAddr:            "the scheme must be socks5 or http",
+	} {
+		s := irc.NewServer(addr, "corgi", "corgi", "Corgi")
+		s.Proxy = proxy
+		if err := s.Connect(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("connecting through %s failed with %v, want %q", proxy, err, want)
+		}
+	}
+}
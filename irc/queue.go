@@ -0,0 +1,211 @@
+package irc
+
+import (
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default flood protection: a burst of 5 lines, then one every 2 seconds
+const (
+	DefaultFloodBurst = 5
+	DefaultFloodRate  = 0.5
+)
+
+// lines waiting to be written to a server. They're released no faster than
+// a token bucket allows, so pastes and mass commands don't get us killed for
+// Excess Flood. Shared between the Server's goroutine and its writer.
+type sendQueue struct {
+	mu     sync.Mutex
+	urgent []string // PING, PONG and QUIT skip ahead of everything else
+	lines  []string
+	wake   chan bool
+	closed bool
+	quit   chan bool // closed once a QUIT has been written
+	burst  float64
+	rate   float64 // tokens per second, unlimited if not positive
+	tokens float64
+	filled time.Time // when tokens was last topped up
+}
+
+func newSendQueue(burst int, rate float64) *sendQueue {
+	if burst < 1 {
+		burst = 1
+	}
+	return &sendQueue{
+		wake:   make(chan bool, 1),
+		quit:   make(chan bool),
+		burst:  float64(burst),
+		rate:   rate,
+		tokens: float64(burst),
+		filled: time.Now()}
+}
+
+// lines that shouldn't wait behind a backlog. A PING stuck behind one would
+// measure the backlog rather than the lag, and could even time out.
+func isUrgent(line string) bool {
+	return strings.HasPrefix(line, "PING") || strings.HasPrefix(line, "PONG") || strings.HasPrefix(line, "QUIT")
+}
+
+func (q *sendQueue) push(line string) {
+	q.mu.Lock()
+	if isUrgent(line) {
+		q.urgent = append(q.urgent, line)
+	} else {
+		q.lines = append(q.lines, line)
+	}
+	q.mu.Unlock()
+	select {
+	case q.wake <- true:
+	default:
+	}
+}
+
+// must be called with mu held
+func (q *sendQueue) refill() {
+	now := time.Now()
+	if q.rate <= 0 {
+		q.tokens = q.burst
+	} else {
+		q.tokens += now.Sub(q.filled).Seconds() * q.rate
+		if q.tokens > q.burst {
+			q.tokens = q.burst
+		}
+	}
+	q.filled = now
+}
+
+// blocks until there's a line that may be sent, returning false once the
+// queue is closed
+func (q *sendQueue) pop() (string, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return "", false
+		}
+		q.refill()
+		if len(q.urgent) > 0 {
+			// urgent lines don't wait for a token, but still use one up
+			line := q.urgent[0]
+			q.urgent = q.urgent[1:]
+			if q.tokens >= 1 {
+				q.tokens--
+			}
+			q.mu.Unlock()
+			return line, true
+		}
+		wait := time.Duration(-1)
+		if len(q.lines) > 0 {
+			if q.tokens >= 1 {
+				line := q.lines[0]
+				q.lines = q.lines[1:]
+				q.tokens--
+				q.mu.Unlock()
+				return line, true
+			}
+			wait = time.Duration((1 - q.tokens) / q.rate * float64(time.Second))
+		}
+		q.mu.Unlock()
+		if wait < 0 {
+			<-q.wake
+		} else {
+			select {
+			case <-q.wake:
+			case <-time.After(wait):
+			}
+		}
+	}
+}
+
+// waits up to timeout for a QUIT to be written, so it isn't lost when the
+// connection is closed straight after
+func (q *sendQueue) waitQuit(timeout time.Duration) {
+	q.mu.Lock()
+	closed := q.closed
+	q.mu.Unlock()
+	if closed {
+		return
+	}
+	select {
+	case <-q.quit:
+	case <-time.After(timeout):
+	}
+}
+
+// must be called after writing each line
+func (q *sendQueue) written(line string) {
+	if !strings.HasPrefix(line, "QUIT") {
+		return
+	}
+	select {
+	case <-q.quit:
+	default:
+		close(q.quit)
+	}
+}
+
+// the lines still waiting for a token, oldest first
+func (q *sendQueue) pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.lines...)
+}
+
+// drops the idx'th pending line, or all of them if idx is negative. Returns
+// how many lines were dropped.
+func (q *sendQueue) cancel(idx int) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if idx < 0 {
+		dropped := len(q.lines)
+		q.lines = nil
+		return dropped
+	} else if idx < len(q.lines) {
+		q.lines = append(q.lines[:idx], q.lines[idx+1:]...)
+		return 1
+	}
+	return 0
+}
+
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	select {
+	case q.wake <- true:
+	default:
+	}
+}
+
+// the only goroutine writing to a connection. sent, if not nil, is told
+// about each line once it's written.
+func writeLoop(queue *sendQueue, conn *textproto.Conn, sent func(line string)) {
+	for line, ok := queue.pop(); ok; line, ok = queue.pop() {
+		conn.Writer.W.WriteString(line + "\r\n")
+		conn.Writer.W.Flush()
+		queue.written(line)
+		if sent != nil {
+			sent(line)
+		}
+	}
+}
+
+// the lines still waiting for flood protection to let them through, oldest
+// first
+func (s *Server) Pending() []string {
+	if s.queue == nil {
+		return nil
+	}
+	return s.queue.pending()
+}
+
+// drops the idx'th line from Pending, or all of them if idx is negative.
+// Returns how many lines were dropped.
+func (s *Server) CancelPending(idx int) int {
+	if s.queue == nil {
+		return 0
+	}
+	return s.queue.cancel(idx)
+}
@@ -0,0 +1,100 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+// pops a line, failing if it isn't want, and returns how long it took
+func popLine(t *testing.T, q *sendQueue, want string) time.Duration {
+	t.Helper()
+	start := time.Now()
+	line, ok := q.pop()
+	if !ok || line != want {
+		t.Fatalf("popped %q, %v, want %q", line, ok, want)
+	}
+	return time.Since(start)
+}
+
+func TestSendQueueBurstAndRefill(t *testing.T) {
+	// a token every 100ms
+	q := newSendQueue(3, 10)
+	for _, line := range []string{"1", "2", "3", "4", "5"} {
+		q.push(line)
+	}
+	start := time.Now()
+	popLine(t, q, "1")
+	popLine(t, q, "2")
+	popLine(t, q, "3")
+	if burst := time.Since(start); burst > 50*time.Millisecond {
+		t.Errorf("the burst took %v, want no waiting", burst)
+	}
+	if waited := popLine(t, q, "4"); waited < 80*time.Millisecond {
+		t.Errorf("line 4 was sent after %v, want it to wait for a token", waited)
+	}
+	popLine(t, q, "5")
+
+	// idle for five tokens' worth, but the bucket only holds three
+	time.Sleep(500 * time.Millisecond)
+	for _, line := range []string{"6", "7", "8", "9"} {
+		q.push(line)
+	}
+	start = time.Now()
+	popLine(t, q, "6")
+	popLine(t, q, "7")
+	popLine(t, q, "8")
+	if burst := time.Since(start); burst > 50*time.Millisecond {
+		t.Errorf("the refilled burst took %v, want no waiting", burst)
+	}
+	if waited := popLine(t, q, "9"); waited < 80*time.Millisecond {
+		t.Errorf("line 9 was sent after %v, want the bucket capped at 3", waited)
+	}
+}
+
+func TestSendQueueUrgent(t *testing.T) {
+	q := newSendQueue(1, 10)
+	q.push("PRIVMSG #go :1")
+	q.push("PRIVMSG #go :2")
+	q.push("PONG :irc.example.org")
+	popLine(t, q, "PONG :irc.example.org")
+	// the PONG used the only token, so even the first message waits
+	if waited := popLine(t, q, "PRIVMSG #go :1"); waited < 80*time.Millisecond {
+		t.Errorf("the first message was sent after %v, want it to wait for a token", waited)
+	}
+	q.push("QUIT :bye")
+	if waited := popLine(t, q, "QUIT :bye"); waited > 50*time.Millisecond {
+		t.Errorf("QUIT waited %v behind a message", waited)
+	}
+	if pending := q.pending(); len(pending) != 1 || pending[0] != "PRIVMSG #go :2" {
+		t.Errorf("pending is %q, want the second message", pending)
+	}
+}
+
+func TestSendQueueUnlimitedAndClose(t *testing.T) {
+	q := newSendQueue(1, 0)
+	for _, line := range []string{"1", "2", "3"} {
+		q.push(line)
+	}
+	start := time.Now()
+	popLine(t, q, "1")
+	popLine(t, q, "2")
+	popLine(t, q, "3")
+	if took := time.Since(start); took > 50*time.Millisecond {
+		t.Errorf("took %v without flood protection, want no waiting", took)
+	}
+
+	popped := make(chan bool)
+	go func() {
+		_, ok := q.pop()
+		popped <- ok
+	}()
+	q.close()
+	select {
+	case ok := <-popped:
+		if ok {
+			t.Error("popped a line from a closed queue")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pop still blocked after close")
+	}
+}
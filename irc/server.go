@@ -0,0 +1,694 @@
+package irc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// how long to wait for a server to answer before giving up on it
+const dialTimeout = 30 * time.Second
+
+// how long to wait before the first attempt to reconnect, and the longest
+// we'll wait between attempts
+const (
+	DefaultReconnectDelay = 10 * time.Second
+	maxReconnectDelay     = 5 * time.Minute
+)
+
+// a connection to an IRC server and our session on it. Once connected, a
+// Server belongs to whichever goroutine runs its Dispatch function: handlers
+// are called there, and everything else, including reading the exported
+// fields, must happen there too. All times are in local time.
+type Server struct {
+	Addr     string // host:port
+	Nick     string
+	User     string
+	RealName string
+	Hostmask string // our nick!user@host as others see it, once we know
+	Channels map[string]*Channel
+	// whether we're connected, though not necessarily registered yet
+	Connected bool
+	// the address we're actually connected to, once we are: the server's
+	// resolved IP and port, or the proxy's
+	RemoteAddr string
+	// whether the server has us marked as away
+	Away bool
+	// other users we know to be away, with their away messages if we know
+	// them, by nick. Kept up to date when the server supports away-notify;
+	// otherwise only learned from replies to messages and WHO.
+	AwayNicks map[string]string
+	// the capabilities the server agreed to
+	EnabledCaps map[string]bool
+	Lag         time.Duration // as of the last PONG
+	InitTime    time.Time
+	UpdateTime  time.Time // when we last sent anything
+
+	// settings, which take effect the next time we connect
+
+	// flood protection: how many lines may be sent at once, then how many
+	// per second. A rate of 0 turns flood protection off.
+	FloodBurst int
+	FloodRate  float64
+	// how often to PING the server, and how long to wait for an answer
+	// before giving up on the connection. 0 turns either off.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// how long to wait before reconnecting after the connection drops,
+	// doubling after each failed attempt. 0 turns reconnecting off.
+	ReconnectDelay time.Duration
+	// connect with TLS, and through a proxy as ParseProxy describes rather
+	// than directly if set
+	TLS   bool
+	Proxy string
+	// "tcp4" or "tcp6" to try the server's IPv4 or IPv6 addresses first,
+	// falling back to the others if none of those answer. Otherwise the
+	// addresses are tried in the order DNS gives them.
+	Family string
+	// the local IP or host name to connect from, e.g. for a vhost
+	LocalAddr string
+	// sent with PASS before registering, for servers and bouncers that need
+	// a password
+	Password string
+	// IRCv3 capabilities to ask for if the server offers them, e.g.
+	// account-tag, negotiated before registering
+	Caps []string
+	// if set, called with every line read from the server or written to it,
+	// e.g. for a protocol log. Runs where handlers do, before they see the
+	// line.
+	Trace func(line string, outgoing bool)
+	// runs fn on the goroutine that owns the Server. Clients with an event
+	// loop of their own, e.g. a Loop, set this before connecting; otherwise
+	// Connect starts a Loop for the Server, which stops once we disconnect
+	// for good.
+	Dispatch func(fn func())
+
+	conn          *textproto.Conn
+	queue         *sendQueue
+	stop          chan bool // closed on disconnect to stop helper goroutines
+	handlers      map[string][]Handler
+	pendingKeys   map[string]string // keys sent with JOINs not yet confirmed
+	registered    bool              // whether the server has welcomed us
+	offeredCaps   []string          // what the server listed in CAP LS so far
+	autoReconnect bool              // whether to reconnect if the connection drops
+	rejoin        bool              // whether to rejoin our channels once registered
+	connecting    bool              // whether ConnectAsync is dialing
+	loop          *Loop             // the Loop we started, if Dispatch wasn't set
+	pingToken     string            // sent with our last PING
+	pingSent      time.Time         // zero when we're not waiting for a PONG
+}
+
+// a Server with the default settings, not yet connected
+func NewServer(addr, nick, user, realName string) *Server {
+	return &Server{
+		Addr:           addr,
+		Nick:           nick,
+		User:           user,
+		RealName:       realName,
+		Channels:       make(map[string]*Channel),
+		AwayNicks:      make(map[string]string),
+		InitTime:       time.Now(),
+		UpdateTime:     time.Now(),
+		FloodBurst:     DefaultFloodBurst,
+		FloodRate:      DefaultFloodRate,
+		PingInterval:   DefaultPingInterval,
+		PingTimeout:    DefaultPingTimeout,
+		ReconnectDelay: DefaultReconnectDelay,
+		pendingKeys:    make(map[string]string)}
+}
+
+// opens a connection to the server as the settings say, returning it and the
+// address it went to
+func (s *Server) dial() (*textproto.Conn, string, error) {
+	family := s.Family
+	if family == "" {
+		family = "tcp"
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if s.LocalAddr != "" {
+		local, err := net.ResolveTCPAddr(family, net.JoinHostPort(s.LocalAddr, "0"))
+		if err != nil && family != "tcp" {
+			local, err = net.ResolveTCPAddr("tcp", net.JoinHostPort(s.LocalAddr, "0"))
+		}
+		if err != nil {
+			return nil, "", errors.New("bad local address " + s.LocalAddr + ": " + err.Error())
+		}
+		dialer.LocalAddr = local
+	}
+	var conn net.Conn
+	var err error
+	if s.Proxy != "" {
+		conn, err = dialProxy(dialer, family, s.Proxy, s.Addr)
+	} else {
+		conn, err = dialPreferring(dialer, family, s.Addr)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	remote := conn.RemoteAddr().String()
+	if s.TLS {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		tlsConn.SetDeadline(time.Now().Add(dialTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, "", errors.New("TLS handshake failed: " + err.Error())
+		}
+		tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	return textproto.NewConn(conn), remote, nil
+}
+
+// dials addr, trying its addresses in family, "tcp4" or "tcp6", before the
+// others, so preferring a family can't leave a server unreachable. Returns
+// the first error if every address fails.
+func dialPreferring(dialer *net.Dialer, family, addr string) (net.Conn, error) {
+	if family != "tcp4" && family != "tcp6" {
+		return dialer.Dial("tcp", addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dialer.Timeout)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	preferred := func(ip net.IP) bool { return (ip.To4() != nil) == (family == "tcp4") }
+	// stable, so DNS's order is kept within each family
+	sort.SliceStable(ips, func(i, j int) bool { return preferred(ips[i]) && !preferred(ips[j]) })
+	var firstErr error
+	for _, ip := range ips {
+		conn, err := dialer.Dial("tcp", net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// dials the server and registers with it. If we've been connected before,
+// the channels we were on are rejoined once the server welcomes us.
+func (s *Server) Connect() error {
+	if s.Connected || s.connecting {
+		return errors.New("already connected to " + s.Addr)
+	}
+	conn, remote, err := s.dial()
+	if err != nil {
+		return err
+	}
+	s.start(conn, remote)
+	return nil
+}
+
+// like Connect, but dials on a goroutine of its own so that Dispatch's
+// goroutine isn't held up by DNS, proxies or a slow server, then calls done
+// there with the result. Disconnect gives up on the attempt, in which case
+// done isn't called.
+func (s *Server) ConnectAsync(done func(err error)) {
+	if s.Connected || s.connecting {
+		done(errors.New("already connected to " + s.Addr))
+		return
+	}
+	s.startLoop()
+	s.connecting = true
+	s.autoReconnect = true
+	// the settings as they are now, since the owner may change them while
+	// we're dialing
+	settings := *s
+	dispatch := s.Dispatch
+	go func() {
+		conn, remote, err := settings.dial()
+		dispatch(func() {
+			if !s.connecting {
+				if conn != nil {
+					conn.Close()
+				}
+				return
+			}
+			s.connecting = false
+			if err == nil {
+				s.start(conn, remote)
+			}
+			done(err)
+		})
+	}()
+}
+
+// whether ConnectAsync is still dialing
+func (s *Server) Connecting() bool {
+	return s.connecting
+}
+
+// starts a Loop to run Dispatch if nobody set one
+func (s *Server) startLoop() {
+	if s.Dispatch == nil {
+		s.loop = NewLoop()
+		go s.loop.Run()
+		s.Dispatch = s.loop.Post
+	}
+}
+
+// stops the Loop startLoop started, if it did, so Connect starts another.
+// Goroutines still winding down hold on to the old one's Post, which is
+// harmless once it's stopped.
+func (s *Server) stopLoop() {
+	if s.loop != nil {
+		s.loop.Stop()
+		s.loop = nil
+		s.Dispatch = nil
+	}
+}
+
+// registers over a freshly dialed connection and starts reading from it
+func (s *Server) start(conn *textproto.Conn, remote string) {
+	s.startLoop()
+	s.conn = conn
+	s.RemoteAddr = remote
+	s.queue = newSendQueue(s.FloodBurst, s.FloodRate)
+	s.Connected = true
+	s.registered = false
+	s.Away = false
+	s.AwayNicks = make(map[string]string)
+	s.autoReconnect = true
+	s.rejoin = len(s.Channels) > 0
+	s.stop = make(chan bool)
+	s.Lag = 0
+	s.pingSent = time.Time{}
+	s.EnabledCaps = make(map[string]bool)
+	s.offeredCaps = nil
+	if s.Password != "" {
+		s.Send("PASS " + s.Password)
+	}
+	if len(s.Caps) > 0 {
+		// servers without capabilities ignore this and just carry on
+		s.Send("CAP LS 302")
+	}
+	if s.Nick != "" {
+		s.Send("NICK " + s.Nick)
+	}
+	s.Send("USER " + s.User + " 0 * :" + s.RealName)
+	// queued before the reader starts, so handlers see it before any lines.
+	// From here on the Server belongs to Dispatch's goroutine, and helpers
+	// keep this Dispatch even if stopLoop replaces it.
+	dispatch := s.Dispatch
+	dispatch(func() {
+		if s.conn == conn {
+			s.emit(&Event{Message: Message{Command: Connected}})
+		}
+	})
+	trace := s.Trace
+	var sent func(line string)
+	if trace != nil {
+		sent = func(line string) { dispatch(func() { trace(line, true) }) }
+	}
+	go writeLoop(s.queue, conn, sent)
+	go s.readLoop(conn, trace, dispatch)
+	go s.pingLoop(s.stop, dispatch)
+}
+
+// reads lines until the connection closes, handing them to dispatch
+func (s *Server) readLoop(conn *textproto.Conn, trace func(line string, outgoing bool), dispatch func(fn func())) {
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			dispatch(func() {
+				// s.conn changes if we reconnect, by which time this
+				// connection has already been dealt with
+				if s.conn == conn {
+					s.connectionLost(err)
+				}
+			})
+			return
+		}
+		dispatch(func() {
+			if s.conn == conn && s.Connected {
+				if trace != nil {
+					trace(line, false)
+				}
+				s.process(line)
+			}
+		})
+	}
+}
+
+// stops the writer and pinger and closes the connection, which in turn
+// stops the reader
+func (s *Server) hangUp() {
+	s.Connected = false
+	close(s.stop)
+	s.queue.close()
+	s.conn.Close()
+}
+
+// the one place a dead connection is dealt with, however it was noticed
+func (s *Server) connectionLost(err error) {
+	if !s.Connected {
+		return
+	}
+	s.hangUp()
+	s.emit(&Event{Message: Message{Command: Disconnected}, Err: err})
+	if s.autoReconnect && s.ReconnectDelay > 0 {
+		s.scheduleReconnect(s.ReconnectDelay, nil)
+	} else {
+		s.stopLoop()
+	}
+}
+
+// tries to reconnect after delay, waiting twice as long each time it fails
+func (s *Server) scheduleReconnect(delay time.Duration, lastErr error) {
+	s.emit(&Event{Message: Message{Command: Reconnecting}, Delay: delay, Err: lastErr})
+	dispatch := s.Dispatch
+	time.AfterFunc(delay, func() {
+		dispatch(func() {
+			// we may have been reconnected or disconnected in the meantime
+			if s.Connected || s.connecting || !s.autoReconnect {
+				return
+			}
+			s.ConnectAsync(func(err error) {
+				if err != nil {
+					delay *= 2
+					if delay > maxReconnectDelay {
+						delay = maxReconnectDelay
+					}
+					s.scheduleReconnect(delay, err)
+				}
+			})
+		})
+	})
+}
+
+// sends QUIT and waits briefly for it to be written, e.g. before exiting
+func (s *Server) Quit(message string) {
+	s.Send("QUIT :" + message)
+	if s.queue != nil {
+		s.queue.waitQuit(time.Second)
+	}
+}
+
+// quits and hangs up without reconnecting. Our channels are remembered, so
+// connecting again rejoins them.
+func (s *Server) Disconnect(message string) {
+	s.autoReconnect = false
+	s.connecting = false
+	defer s.stopLoop()
+	if !s.Connected {
+		return
+	}
+	s.Quit(message)
+	s.hangUp()
+	s.emit(&Event{Message: Message{Command: Disconnected}})
+}
+
+// queues a raw line, without its CRLF, to be sent as soon as flood
+// protection allows
+func (s *Server) Send(line string) {
+	if s.queue != nil {
+		s.queue.push(line)
+	}
+	s.UpdateTime = time.Now()
+}
+
+// whether the server has welcomed us since we connected
+func (s *Server) Registered() bool {
+	return s.registered
+}
+
+// asks for a new nick. Once registered, Nick only changes when the server
+// confirms it.
+func (s *Server) SetNick(nick string) {
+	// TODO the nick isn't always set - see error cases at
+	// https://tools.ietf.org/html/rfc1459#section-4.1.2
+	if !s.registered {
+		s.Nick = nick
+	}
+	s.Send("NICK " + nick)
+}
+
+// marks us away with message, or back if it's empty. Away only changes once
+// the server confirms it.
+func (s *Server) SetAway(message string) {
+	if message == "" {
+		s.Send("AWAY")
+	} else {
+		s.Send("AWAY :" + message)
+	}
+}
+
+// sends a single JOIN for all the given channels, with optional keys in the
+// same order. Without a key, the one we last joined a channel with is used.
+func (s *Server) Join(channelNames, keys []string) {
+	// the server matches keys to channels by position, so keyed channels are
+	// listed first
+	var keyed, unkeyed, usedKeys []string
+	for idx, channelName := range channelNames {
+		key := ""
+		if idx < len(keys) {
+			key = keys[idx]
+		} else if s.Channels[channelName] != nil {
+			key = s.Channels[channelName].Key
+		}
+		if key != "" {
+			s.pendingKeys[channelName] = key
+			keyed = append(keyed, channelName)
+			usedKeys = append(usedKeys, key)
+		} else {
+			unkeyed = append(unkeyed, channelName)
+		}
+	}
+	line := "JOIN " + strings.Join(append(keyed, unkeyed...), ",")
+	if len(usedKeys) > 0 {
+		line += " " + strings.Join(usedKeys, ",")
+	}
+	s.Send(line)
+}
+
+// leaves a channel
+func (s *Server) Part(channelName string) {
+	s.Send("PART " + channelName)
+}
+
+// joins every channel we were on, with the keys we used
+func (s *Server) rejoinChannels() {
+	var channelNames []string
+	for name := range s.Channels {
+		channelNames = append(channelNames, name)
+	}
+	if len(channelNames) > 0 {
+		sort.Strings(channelNames)
+		s.Join(channelNames, nil)
+	}
+}
+
+// the server refused or redirected a JOIN, so forget any key we sent with it
+func (s *Server) joinFailed(channelName string) {
+	delete(s.pendingKeys, channelName)
+}
+
+// the server's side of capability negotiation: ask for the capabilities we
+// want out of those it offers, then end negotiation once it's answered so
+// registration can finish
+func (s *Server) negotiateCaps(msg Message) {
+	// params are our nick, the subcommand, then the capabilities
+	switch msg.Param(1) {
+	case "LS":
+		for _, capability := range strings.Fields(msg.Text()) {
+			// drop values like sasl=PLAIN,EXTERNAL
+			s.offeredCaps = append(s.offeredCaps, strings.SplitN(capability, "=", 2)[0])
+		}
+		// a * before the list means there are more lines to come
+		if msg.Param(2) == "*" && len(msg.Params) > 3 {
+			return
+		}
+		var wanted []string
+		for _, capability := range s.Caps {
+			for _, offered := range s.offeredCaps {
+				if capability == offered {
+					wanted = append(wanted, capability)
+					break
+				}
+			}
+		}
+		if len(wanted) > 0 {
+			s.Send("CAP REQ :" + strings.Join(wanted, " "))
+		} else {
+			s.endCaps()
+		}
+	case "ACK":
+		for _, capability := range strings.Fields(msg.Text()) {
+			if strings.HasPrefix(capability, "-") {
+				delete(s.EnabledCaps, capability[1:])
+			} else {
+				s.EnabledCaps[capability] = true
+			}
+		}
+		s.endCaps()
+	case "NAK":
+		s.endCaps()
+	case "DEL":
+		for _, capability := range strings.Fields(msg.Text()) {
+			delete(s.EnabledCaps, capability)
+		}
+	}
+}
+
+func (s *Server) endCaps() {
+	if !s.registered {
+		s.Send("CAP END")
+	}
+}
+
+// nick has left the channel, and if that's us, forget it
+func (s *Server) leave(channelName, nick string) {
+	channel := s.Channels[channelName]
+	if channel == nil {
+		return
+	}
+	channel.removeNick(nick)
+	if nick == s.Nick {
+		delete(s.Channels, channelName)
+	}
+}
+
+// updates the session for a line from the server, then hands it to the
+// handlers
+func (s *Server) process(line string) {
+	msg := ParseMessage(line)
+	ev := &Event{Message: msg, Raw: line, Self: msg.Prefix != "" && msg.Nick() == s.Nick}
+	channelName := msg.Param(0)
+	switch msg.Command {
+	case "PING":
+		s.Send("PONG :" + msg.Param(0))
+	case "PONG":
+		s.gotPong(msg.Text())
+	case "CAP":
+		s.negotiateCaps(msg)
+	case "001": // welcome, which usually ends with our nick!user@host
+		s.registered = true
+		if nick := msg.Param(0); nick != "" {
+			s.Nick = nick
+		}
+		if fields := strings.Fields(msg.Text()); len(fields) > 0 {
+			if last := fields[len(fields)-1]; strings.Contains(last, "!") && strings.Contains(last, "@") {
+				s.Hostmask = last
+			}
+		}
+		s.emit(&Event{Message: Message{Command: Registered}})
+		if s.rejoin {
+			s.rejoin = false
+			s.rejoinChannels()
+		}
+	case "305": // no longer away
+		s.Away = false
+	case "306": // marked as away
+		s.Away = true
+	case "396": // our displayed host changed, e.g. a cloak was applied
+		if len(msg.Params) > 1 {
+			s.setHost(msg.Param(1))
+		}
+	case "JOIN":
+		channel := s.Channels[channelName]
+		if ev.Self {
+			s.Hostmask = msg.Prefix
+			if channel == nil {
+				channel = NewChannel(channelName)
+				s.Channels[channelName] = channel
+			} else {
+				// rejoining, so start the nick list over
+				channel.Nicks = make(map[string]bool)
+			}
+			if key, ok := s.pendingKeys[channelName]; ok {
+				channel.Key = key
+				delete(s.pendingKeys, channelName)
+			}
+			if s.EnabledCaps["away-notify"] {
+				// away-notify only tells us about changes, so ask who's
+				// away already
+				s.Send("WHO " + channelName)
+			}
+		}
+		if channel != nil {
+			channel.addNick(msg.Nick())
+		}
+		ev.Channel = channel
+	case "PART":
+		ev.Channel = s.Channels[channelName]
+		s.leave(channelName, msg.Nick())
+	case "KICK": // the channel, the victim, then the reason
+		ev.Channel = s.Channels[channelName]
+		s.leave(channelName, msg.Param(1))
+	case "QUIT":
+		for _, channel := range s.Channels {
+			if channel.Nicks[msg.Nick()] {
+				ev.Channels = append(ev.Channels, channel)
+				channel.removeNick(msg.Nick())
+			}
+		}
+		delete(s.AwayNicks, msg.Nick())
+	case "NICK":
+		newNick := msg.Param(0)
+		for _, channel := range s.Channels {
+			if channel.Nicks[msg.Nick()] {
+				ev.Channels = append(ev.Channels, channel)
+				channel.renameNick(msg.Nick(), newNick)
+			}
+		}
+		if message, ok := s.AwayNicks[msg.Nick()]; ok {
+			delete(s.AwayNicks, msg.Nick())
+			s.AwayNicks[newNick] = message
+		}
+		if ev.Self {
+			s.Nick = newNick
+			if strings.Contains(s.Hostmask, "!") {
+				s.Hostmask = newNick + s.Hostmask[strings.Index(s.Hostmask, "!"):]
+			}
+		}
+	case "PRIVMSG":
+		if channel := s.Channels[channelName]; channel != nil {
+			channel.LastSpoke[msg.Nick()] = time.Now()
+			ev.Channel = channel
+		}
+	case "AWAY": // from away-notify: with a message they're away, without it they're back
+		if len(msg.Params) > 0 {
+			s.AwayNicks[msg.Nick()] = msg.Param(0)
+		} else {
+			delete(s.AwayNicks, msg.Nick())
+		}
+	case "301": // away reply: our nick, their nick, then their message
+		s.AwayNicks[msg.Param(1)] = msg.Param(2)
+	case "352": // WHO reply: our nick, channel, user, host, server, nick, then H(ere) or G(one)
+		nick := msg.Param(5)
+		if strings.HasPrefix(msg.Param(6), "G") {
+			if _, ok := s.AwayNicks[nick]; !ok {
+				s.AwayNicks[nick] = ""
+			}
+		} else {
+			delete(s.AwayNicks, nick)
+		}
+	case "353": // list of nicks: our nick, the channel type, the channel, then the nicks
+		if channel := s.Channels[msg.Param(2)]; channel != nil {
+			for _, nick := range strings.Fields(msg.Text()) {
+				// discard operator and voice prefixes
+				channel.addNick(strings.TrimLeft(nick, "~&@%+"))
+			}
+			ev.Channel = channel
+		}
+	case "470": // forwarded: our nick, the requested channel, then the target
+		s.joinFailed(msg.Param(1))
+	case "403", "405", "471", "473", "474", "475", "477": // JOIN failures
+		s.joinFailed(msg.Param(1))
+	default:
+		ev.Channel = s.Channels[channelName]
+	}
+	s.emit(ev)
+}
@@ -0,0 +1,408 @@
+package irc_test
+
+import (
+	"github.com/natemealey/corgi/irc"
+	"github.com/natemealey/corgi/irc/irctest"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runs fn where s's handlers run and waits for it to finish
+func onServer(s *irc.Server, fn func()) {
+	done := make(chan bool)
+	s.Dispatch(func() {
+		fn()
+		close(done)
+	})
+	<-done
+}
+
+// a Server for fs, changed by setup if it's not nil, then connected. Its
+// events go to the channel returned, and it runs on a Loop of its own until
+// the test ends.
+func startServer(t *testing.T, fs *irctest.Server, setup func(s *irc.Server)) (*irc.Server, *irctest.Conn, chan *irc.Event) {
+	t.Helper()
+	s := irc.NewServer(fs.Addr(), "corgi", "corgi", "Corgi")
+	s.FloodRate = 0
+	s.PingInterval = 0
+	s.ReconnectDelay = 0
+	loop := irc.NewLoop()
+	go loop.Run()
+	s.Dispatch = loop.Post
+	events := make(chan *irc.Event, 100)
+	s.Handle(irc.AnyCommand, func(ev *irc.Event) { events <- ev })
+	if setup != nil {
+		setup(s)
+	}
+	if err := s.Connect(); err != nil {
+		t.Fatalf("failed to connect to %s: %v", s.Addr, err)
+	}
+	t.Cleanup(func() {
+		onServer(s, func() { s.Disconnect("") })
+		loop.Stop()
+	})
+	return s, fs.NextConn(), events
+}
+
+// waits for an event with the given command, skipping any others
+func expectEvent(t *testing.T, events chan *irc.Event, command string) *irc.Event {
+	t.Helper()
+	deadline := time.After(irctest.Timeout)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Command == command {
+				return ev
+			}
+		case <-deadline:
+			t.Fatalf("no %s event", command)
+			return nil
+		}
+	}
+}
+
+func TestSessionAndReconnect(t *testing.T) {
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "@alice", "+bob")
+	s, c, events := startServer(t, fs, func(s *irc.Server) { s.ReconnectDelay = 10 * time.Millisecond })
+	c.Expect("USER corgi 0 * :Corgi")
+	expectEvent(t, events, irc.Connected)
+	expectEvent(t, events, "001")
+
+	onServer(s, func() { s.Join([]string{"#go"}, []string{"hunter2"}) })
+	c.Expect("JOIN #go hunter2")
+	if ev := expectEvent(t, events, "JOIN"); !ev.Self || ev.Channel == nil {
+		t.Errorf("our JOIN should be marked as ours and come with its channel")
+	}
+	expectEvent(t, events, "353")
+	onServer(s, func() {
+		channel := s.Channels["#go"]
+		if channel == nil || channel.Key != "hunter2" {
+			t.Fatalf("#go wasn't joined with its key")
+		}
+		for _, nick := range []string{"corgi", "alice", "bob"} {
+			if !channel.Nicks[nick] {
+				t.Errorf("%s missing from the nick list", nick)
+			}
+		}
+	})
+
+	c.Send(":alice!alice@localhost NICK :carol")
+	if ev := expectEvent(t, events, "NICK"); len(ev.Channels) != 1 || ev.Self {
+		t.Errorf("alice's nick change should list the one channel we share")
+	}
+	c.Send(":bob!bob@localhost QUIT :bye")
+	expectEvent(t, events, "QUIT")
+	onServer(s, func() {
+		nicks := s.Channels["#go"].Nicks
+		if nicks["alice"] || !nicks["carol"] || nicks["bob"] {
+			t.Errorf("nick list is %v after a NICK and a QUIT", nicks)
+		}
+	})
+
+	c.Close()
+	if ev := expectEvent(t, events, irc.Disconnected); ev.Err == nil {
+		t.Errorf("a dropped connection should say why")
+	}
+	expectEvent(t, events, irc.Reconnecting)
+	c = fs.NextConn()
+	c.Expect("NICK corgi")
+	c.Expect("JOIN #go hunter2")
+	expectEvent(t, events, irc.Connected)
+}
+
+func TestAwayTracking(t *testing.T) {
+	fs := irctest.NewServer(t)
+	fs.SetMembers("#go", "alice", "bob")
+	fs.On("CAP", func(c *irctest.Conn, msg irc.Message) {
+		switch msg.Param(0) {
+		case "LS":
+			c.Send(":fake.server CAP * LS :away-notify")
+		case "REQ":
+			c.Send(":fake.server CAP * ACK :" + msg.Text())
+		}
+	})
+	s, c, events := startServer(t, fs, func(s *irc.Server) { s.Caps = []string{"away-notify"} })
+	c.Expect("CAP REQ :away-notify")
+	expectEvent(t, events, "001")
+
+	onServer(s, func() { s.Join([]string{"#go"}, nil) })
+	c.Expect("WHO #go")
+	c.Send(":fake.server 352 corgi #go alice localhost fake.server alice G :0 Alice")
+	c.Send(":fake.server 352 corgi #go bob localhost fake.server bob H@ :0 Bob")
+	c.Send(":fake.server 315 corgi #go :End of /WHO list.")
+	expectEvent(t, events, "315")
+	onServer(s, func() {
+		if _, away := s.AwayNicks["alice"]; !away {
+			t.Errorf("alice should be away from the WHO reply")
+		}
+		if _, away := s.AwayNicks["bob"]; away {
+			t.Errorf("bob shouldn't be away")
+		}
+	})
+
+	c.Send(":bob!bob@localhost AWAY :lunch")
+	c.Send(":alice!alice@localhost AWAY")
+	c.Send(":bob!bob@localhost NICK :bob_lunch")
+	expectEvent(t, events, "NICK")
+	onServer(s, func() {
+		if len(s.AwayNicks) != 1 || s.AwayNicks["bob_lunch"] != "lunch" {
+			t.Errorf("away nicks are %v, want only bob_lunch", s.AwayNicks)
+		}
+		s.SetAway("brb")
+	})
+	c.Expect("AWAY :brb")
+	c.Send(":fake.server 306 corgi :You have been marked as being away")
+	expectEvent(t, events, "306")
+	onServer(s, func() {
+		if !s.Away {
+			t.Errorf("we should be away")
+		}
+	})
+}
+
+func TestPasswordAndRegistered(t *testing.T) {
+	fs := irctest.NewServer(t)
+	s, c, events := startServer(t, fs, func(s *irc.Server) {
+		s.ReconnectDelay = 10 * time.Millisecond
+		s.Password = "hunter2"
+		s.Handle(irc.Registered, func(ev *irc.Event) { s.Send("PRIVMSG NickServ :IDENTIFY secret") })
+	})
+	c.Expect("PASS hunter2")
+	c.Expect("NICK corgi")
+	expectEvent(t, events, irc.Registered)
+	c.Expect("PRIVMSG NickServ :IDENTIFY secret")
+	onServer(s, func() { s.Join([]string{"#go"}, nil) })
+	expectEvent(t, events, "JOIN")
+
+	// identifying has to come before rejoining, for channels only
+	// registered users may join
+	c.Close()
+	c = fs.NextConn()
+	c.Expect("PASS hunter2")
+	c.Expect("PRIVMSG NickServ :IDENTIFY secret")
+	c.Expect("JOIN #go")
+}
+
+func TestDialSettings(t *testing.T) {
+	fs := irctest.NewServer(t)
+	_, port, _ := net.SplitHostPort(fs.Addr())
+	// the server only has an IPv4 address, so preferring IPv6 falls back
+	for _, family := range []string{"tcp4", "tcp6"} {
+		for _, addr := range []string{fs.Addr(), "localhost:" + port} {
+			s, c, _ := startServer(t, fs, func(s *irc.Server) {
+				s.Addr = addr
+				s.Family = family
+				s.LocalAddr = "127.0.0.1"
+			})
+			c.Expect("USER")
+			onServer(s, func() {
+				if s.RemoteAddr != fs.Addr() {
+					t.Errorf("connected to %s preferring %s at %q, want %q", addr, family, s.RemoteAddr, fs.Addr())
+				}
+			})
+		}
+	}
+	s := irc.NewServer(fs.Addr(), "corgi", "corgi", "Corgi")
+	s.LocalAddr = "no such host.invalid"
+	if err := s.Connect(); err == nil || !strings.Contains(err.Error(), "bad local address") {
+		t.Errorf("connecting from a bad local address failed with %v", err)
+	}
+}
+
+func TestPingLagAndTimeout(t *testing.T) {
+	fs := irctest.NewServer(t)
+	s, c, events := startServer(t, fs, func(s *irc.Server) {
+		// enough to register, then one line every 10 seconds
+		s.FloodBurst = 10
+		s.FloodRate = 0.1
+		s.PingInterval = 60 * time.Millisecond
+		s.PingTimeout = 300 * time.Millisecond
+	})
+	expectEvent(t, events, "001")
+
+	onServer(s, func() {
+		for idx := 0; idx < 20; idx++ {
+			s.Send("PRIVMSG #go :backlog")
+		}
+	})
+	// the PING goes ahead of the backlog, and the lag doesn't include it
+	ping := c.Expect("PING")
+	c.Send(":fake.server PONG fake.server :" + strings.TrimPrefix(ping, "PING :"))
+	expectEvent(t, events, "PONG")
+	onServer(s, func() {
+		if s.Lag <= 0 || s.Lag > time.Second {
+			t.Errorf("lag is %v, want it measured without the backlog", s.Lag)
+		}
+		if len(s.Pending()) == 0 {
+			t.Errorf("the backlog was sent already, so the PING didn't have to skip it")
+		}
+	})
+
+	// then stop answering
+	c.Expect("PING")
+	if ev := expectEvent(t, events, irc.Disconnected); ev.Err == nil || !strings.Contains(ev.Err.Error(), "PING") {
+		t.Errorf("disconnected with %v, want the ping timeout", ev.Err)
+	}
+}
+
+func TestConnectAsync(t *testing.T) {
+	// a proxy that never answers, until released
+	release := make(chan bool)
+	stalled := fakeProxy(t, func(conn net.Conn) { <-release })
+	s := irc.NewServer("irc.example.org:6667", "corgi", "corgi", "Corgi")
+	s.PingInterval = 0
+	s.Proxy = "http://" + stalled
+	loop := irc.NewLoop()
+	go loop.Run()
+	defer loop.Stop()
+	s.Dispatch = loop.Post
+	results := make(chan error, 1)
+	onServer(s, func() { s.ConnectAsync(func(err error) { results <- err }) })
+	// the loop carries on while the proxy stalls
+	onServer(s, func() {
+		if !s.Connecting() || s.Connected {
+			t.Errorf("should be connecting")
+		}
+		s.Disconnect("")
+	})
+	close(release)
+	select {
+	case err := <-results:
+		t.Errorf("an attempt given up on finished with %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	fs := irctest.NewServer(t)
+	events := make(chan *irc.Event, 100)
+	s.Handle(irc.AnyCommand, func(ev *irc.Event) { events <- ev })
+	onServer(s, func() {
+		s.Addr = fs.Addr()
+		s.Proxy = ""
+		s.ConnectAsync(func(err error) { results <- err })
+	})
+	fs.NextConn().Expect("USER corgi")
+	if err := <-results; err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	expectEvent(t, events, "001")
+	onServer(s, func() {
+		s.ConnectAsync(func(err error) { results <- err })
+		s.Disconnect("")
+	})
+	if err := <-results; err == nil {
+		t.Errorf("connecting twice should fail")
+	}
+}
+
+func TestQuitIsWritten(t *testing.T) {
+	fs := irctest.NewServer(t)
+	s, c, events := startServer(t, fs, func(s *irc.Server) {
+		s.FloodBurst = 10
+		s.FloodRate = 0.1
+	})
+	expectEvent(t, events, "001")
+	// QUIT skips the backlog, and is written before we hang up
+	onServer(s, func() {
+		for idx := 0; idx < 20; idx++ {
+			s.Send("PRIVMSG #go :backlog")
+		}
+		s.Disconnect("bye")
+	})
+	c.Expect("QUIT :bye")
+	c.ExpectClosed()
+}
+
+func TestJoinKeysAndErrors(t *testing.T) {
+	fs := irctest.NewServer(t)
+	// #secret wants a key until it's unlocked
+	var mu sync.Mutex
+	secretKey := "hunter2"
+	fs.On("JOIN", func(c *irctest.Conn, msg irc.Message) {
+		keys := strings.Split(msg.Param(1), ",")
+		for idx, channelName := range strings.Split(msg.Param(0), ",") {
+			key := ""
+			if idx < len(keys) {
+				key = keys[idx]
+			}
+			mu.Lock()
+			refused := channelName == "#secret" && secretKey != "" && key != secretKey
+			mu.Unlock()
+			if refused {
+				c.Send(":fake.server 475 corgi #secret :Cannot join channel (+k)")
+			} else {
+				c.Send(":" + c.Prefix() + " JOIN " + channelName)
+			}
+		}
+	})
+	s, c, events := startServer(t, fs, nil)
+	expectEvent(t, events, "001")
+
+	onServer(s, func() { s.Join([]string{"#open", "#secret"}, []string{"", "wrong"}) })
+	c.Expect("JOIN #secret,#open wrong")
+	expectEvent(t, events, "475")
+	expectEvent(t, events, "JOIN")
+	onServer(s, func() {
+		if s.Channels["#secret"] != nil || s.Channels["#open"] == nil {
+			t.Errorf("joined %v, want only #open", s.Channels)
+		}
+	})
+
+	// the wrong key was forgotten, so it isn't taken for #secret's key once
+	// we get in without one
+	mu.Lock()
+	secretKey = ""
+	mu.Unlock()
+	onServer(s, func() { s.Join([]string{"#secret"}, nil) })
+	c.Expect("JOIN #secret")
+	expectEvent(t, events, "JOIN")
+	onServer(s, func() {
+		if channel := s.Channels["#secret"]; channel == nil || channel.Key != "" {
+			t.Errorf("#secret was joined with %+v, want no key", channel)
+		}
+		s.Part("#secret")
+	})
+	c.Expect("PART #secret")
+	c.Send(":" + c.Prefix() + " PART #secret")
+	expectEvent(t, events, "PART")
+
+	// a key that works is kept for rejoining
+	mu.Lock()
+	secretKey = "hunter2"
+	mu.Unlock()
+	onServer(s, func() { s.Join([]string{"#secret"}, []string{"hunter2"}) })
+	c.Expect("JOIN #secret hunter2")
+	expectEvent(t, events, "JOIN")
+	onServer(s, func() {
+		if channel := s.Channels["#secret"]; channel == nil || channel.Key != "hunter2" {
+			t.Errorf("#secret was joined with %+v, want its key", channel)
+		}
+	})
+}
+
+func TestOwnLoopStops(t *testing.T) {
+	fs := irctest.NewServer(t)
+	s := irc.NewServer(fs.Addr(), "corgi", "corgi", "Corgi")
+	s.PingInterval = 0
+	for attempt := 1; attempt <= 2; attempt++ {
+		events := make(chan *irc.Event, 100)
+		s.Handle(irc.AnyCommand, func(ev *irc.Event) { events <- ev })
+		if err := s.Connect(); err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		fs.NextConn().Expect("USER")
+		expectEvent(t, events, "001")
+		if s.Dispatch == nil {
+			t.Fatalf("Connect didn't start a Loop")
+		}
+		// the Loop Connect started goes once we're done with it, and the
+		// next Connect starts another
+		onServer(s, func() { s.Disconnect("") })
+		if s.Dispatch != nil {
+			t.Errorf("the Loop is still there after disconnecting, attempt %d", attempt)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package irc
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// the longest line a server accepts, including the trailing CRLF
+const MaxLineLen = 512
+
+// until the server tells us our user@host, assume the longest that servers
+// commonly allow
+const (
+	maxUserLen = 10
+	maxHostLen = 63
+)
+
+// how much text fits in a `command target :text` line once the server has
+// put our nick!user@host prefix in front of it for everyone else
+func (s *Server) maxTextLen(command, target string) int {
+	prefix := s.Hostmask
+	if prefix == "" {
+		prefix = s.Nick + "!" + strings.Repeat("x", maxUserLen) + "@" + strings.Repeat("x", maxHostLen)
+	}
+	return MaxLineLen - len("\r\n") - len(":"+prefix+" ") - len(command+" "+target+" :")
+}
+
+// remembers the host the server shows us as, keeping our nick and user
+func (s *Server) setHost(host string) {
+	user := s.User
+	if at := strings.Index(s.Hostmask, "@"); at >= 0 {
+		user = s.Hostmask[strings.Index(s.Hostmask, "!")+1 : at]
+	}
+	s.Hostmask = s.Nick + "!" + user + "@" + host
+}
+
+// splits text into chunks of at most limit bytes, breaking at the last space
+// that fits. Words too long for a chunk of their own are broken between runes
+// so no chunk ends with half a UTF-8 character.
+func splitText(text string, limit int) []string {
+	if limit < utf8.UTFMax {
+		limit = utf8.UTFMax
+	}
+	var chunks []string
+	for len(text) > limit {
+		if cut := strings.LastIndex(text[:limit+1], " "); cut > 0 {
+			chunks = append(chunks, text[:cut])
+			text = text[cut+1:]
+		} else {
+			cut = limit
+			for cut > 1 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			chunks = append(chunks, text[:cut])
+			text = text[cut:]
+		}
+	}
+	return append(chunks, text)
+}
+
+// sends text to target as one or more command (PRIVMSG or NOTICE) lines,
+// each wrapped in before and after, and split so that none get truncated.
+// Returns the text of each line sent.
+func (s *Server) sendSplit(command, target, text, before, after string) []string {
+	var sent []string
+	limit := s.maxTextLen(command, target) - len(before) - len(after)
+	for _, chunk := range splitText(text, limit) {
+		sent = append(sent, before+chunk+after)
+		s.Send(command + " " + target + " :" + before + chunk + after)
+	}
+	return sent
+}
+
+// sends text to target as PRIVMSG or NOTICE lines, split so that none get
+// truncated. Returns the text of each line sent.
+func (s *Server) SendText(command, target, text string) []string {
+	return s.sendSplit(command, target, text, "", "")
+}
+
+// sends text to target as a CTCP ACTION, like /me. Returns the text of each
+// PRIVMSG sent, ACTION and all.
+func (s *Server) SendAction(target, text string) []string {
+	return s.sendSplit("PRIVMSG", target, text, "\x01ACTION ", "\x01")
+}
@@ -0,0 +1,74 @@
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"", 10, []string{""}},
+		{"exactly10!", 10, []string{"exactly10!"}},
+		{"hello there world", 11, []string{"hello there", "world"}},
+		{"hello there world", 10, []string{"hello", "there", "world"}},
+		// no spaces, so broken wherever it's full
+		{"abcdefghijkl", 5, []string{"abcde", "fghij", "kl"}},
+		{"ab abcdefghijkl", 5, []string{"ab", "abcde", "fghij", "kl"}},
+		// two-byte runes never split in half
+		{"ééééé", 5, []string{"éé", "éé", "é"}},
+		{"aééé", 4, []string{"aé", "éé"}},
+		// a four-byte rune always fits, however small the limit
+		{"🐕🐕", 1, []string{"🐕", "🐕"}},
+		{"日本 語です", 7, []string{"日本", "語で", "す"}},
+	}
+	for _, test := range tests {
+		got := splitText(test.text, test.limit)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitText(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+		}
+		for _, chunk := range got {
+			if !utf8.ValidString(chunk) {
+				t.Errorf("splitText(%q, %d) has invalid chunk %q", test.text, test.limit, chunk)
+			}
+		}
+	}
+}
+
+func TestMaxTextLen(t *testing.T) {
+	s := NewServer("localhost:6667", "corgi", "corgi", "Corgi")
+	text := strings.Repeat("word ", 200) + strings.Repeat("ü", 300)
+	for _, hostmask := range []string{"", "corgi!c@h", "corgi!~corgiuser@" + strings.Repeat("h", 63)} {
+		s.Hostmask = hostmask
+		prefix := hostmask
+		if prefix == "" {
+			// the longest we assume before the server tells us
+			prefix = "corgi!" + strings.Repeat("u", maxUserLen) + "@" + strings.Repeat("h", maxHostLen)
+		}
+		var joined []string
+		for _, chunk := range splitText(text, s.maxTextLen("PRIVMSG", "#go")) {
+			line := ":" + prefix + " PRIVMSG #go :" + chunk + "\r\n"
+			if len(line) > MaxLineLen {
+				t.Errorf("with hostmask %q, a %d byte line was sent", hostmask, len(line))
+			}
+			joined = append(joined, chunk)
+		}
+		// only the spaces the text was split at are dropped
+		if strings.ReplaceAll(strings.Join(joined, ""), " ", "") != strings.ReplaceAll(text, " ", "") {
+			t.Errorf("with hostmask %q, the chunks don't add up to the text", hostmask)
+		}
+	}
+	// the full hostmask leaves less room than a short one
+	s.Hostmask = "corgi!c@h"
+	short := s.maxTextLen("PRIVMSG", "#go")
+	s.Hostmask = ""
+	if long := s.maxTextLen("PRIVMSG", "#go"); long >= short {
+		t.Errorf("maxTextLen is %d before the hostmask is known, want less than %d", long, short)
+	}
+}